@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/negroni"
+	"github.com/meatballhat/negroni-logrus"
+	"github.com/rusenask/lgc"
+)
+
+func main() {
+	// Output to stderr instead of stdout, could also be a file.
+	log.SetOutput(os.Stderr)
+
+	// getting configuration
+	file, err := os.Open("conf.json")
+	if err != nil {
+		log.Panic("Failed to open configuration file, quiting server.")
+	}
+	decoder := json.NewDecoder(file)
+	config := lgc.Configuration{}
+	err = decoder.Decode(&config)
+	if err != nil {
+		log.WithFields(log.Fields{"Error": err.Error()}).Panic("Failed to read configuration")
+	}
+	// configuring logger based on environment settings
+	if config.Environment == "production" {
+		// Log as JSON instead of the default ASCII formatter.
+		log.SetFormatter(&log.JSONFormatter{})
+		// TODO: also, write to file, probably log file path should also be configurable
+	} else {
+		// The TextFormatter is default
+		log.SetFormatter(&log.TextFormatter{})
+	}
+
+	if config.Debug == true {
+		log.SetLevel(log.DebugLevel)
+		log.Info("Starting server with debug mode initiated...")
+	}
+	// looking for option args when starting App
+	// like ./lgc -port=":3000" would start on port 3000
+	var port = flag.String("port", ":3000", "Server port")
+	flag.Parse() // parse the flag
+
+	log.WithFields(log.Fields{
+		"StuboHost": config.StuboHost,
+		"StuboPort": config.StuboPort,
+		"StuboURI":  config.StuboURI(),
+		"ProxyPort": port,
+		"Version":   lgc.Version,
+		"LegacyURI": config.LegacyStuboURI,
+	}).Info("LGC is starting")
+
+	if len(config.Upstreams.URIs) > 0 {
+		log.WithFields(log.Fields{
+			"Upstreams": config.Upstreams.URIs,
+			"Strategy":  config.Upstreams.Strategy,
+		}).Info("Using multiple Stubo nodes")
+	}
+	proxy, err := lgc.NewProxy(config)
+	if err != nil {
+		log.WithFields(log.Fields{"Error": err.Error()}).Panic("Failed to create proxy")
+	}
+	defer proxy.Close()
+
+	n := negroni.Classic()
+	n.Use(negronilogrus.NewMiddleware())
+	n.UseHandler(proxy.Handler())
+
+	server := lgc.NewServer(*port, n, config.Timeouts)
+	log.WithFields(log.Fields{
+		"ProxyPort": *port,
+	}).Info("Listening")
+	log.Fatal(server.ListenAndServe())
+}
@@ -0,0 +1,156 @@
+package lgc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// command is a single legacy API call from commands file, such as:
+// put/stub?session=first_1&delay_policy=slow,first.textMatcher,first.response
+// files listed after the URL (separated by commas) are used as request body.
+// put/stub lists matcher files followed by response file, other commands
+// list a single file
+type command struct {
+	line  string
+	path  string
+	query string
+	files []string
+}
+
+// method returns HTTP method that should be used to dispatch command
+func (c command) method() string {
+	if len(c.files) > 0 || c.path == "/stubo/api/put/stub" || c.path == "/stubo/api/get/response" {
+		return "POST"
+	}
+	return "GET"
+}
+
+// parseCommands parses commands file, empty lines and lines starting
+// with '#' are skipped
+func parseCommands(text []byte) ([]command, error) {
+	var commands []command
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		url := strings.TrimSpace(parts[0])
+
+		var c command
+		c.line = line
+		if idx := strings.Index(url, "?"); idx != -1 {
+			c.path, c.query = url[:idx], url[idx+1:]
+		} else {
+			c.path = url
+		}
+		c.path = "/" + strings.TrimPrefix(c.path, "/")
+		if !strings.HasPrefix(c.path, "/stubo/api/") {
+			c.path = "/stubo/api" + c.path
+		}
+		for _, file := range parts[1:] {
+			if file = strings.TrimSpace(file); file != "" {
+				c.files = append(c.files, file)
+			}
+		}
+		commands = append(commands, c)
+	}
+	return commands, scanner.Err()
+}
+
+// resolveCommandsPath joins name with commands directory, names pointing
+// outside of it are rejected
+func resolveCommandsPath(dir, name string) (string, error) {
+	if dir == "" {
+		return "", errors.New("commands directory is not configured")
+	}
+	if filepath.IsAbs(name) {
+		return "", errors.New("absolute paths are not allowed: " + name)
+	}
+	base := filepath.Clean(dir)
+	path := filepath.Join(base, name)
+	if path != base && !strings.HasPrefix(path, base+string(filepath.Separator)) {
+		return "", errors.New("path is outside of commands directory: " + name)
+	}
+	return path, nil
+}
+
+// commandBody returns request body of the command. put/stub body is API v2
+// stub built from matcher and response files, other commands send their file
+// as it is
+func commandBody(dir string, c command) ([]byte, error) {
+	var contents [][]byte
+	for _, file := range c.files {
+		path, err := resolveCommandsPath(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, content)
+	}
+	switch {
+	case len(contents) == 0:
+		return nil, nil
+	case c.path == "/stubo/api/put/stub":
+		if len(contents) < 2 {
+			return nil, errors.New("put/stub needs matcher and response files")
+		}
+		return legacyStub(contents[:len(contents)-1], contents[len(contents)-1])
+	case len(contents) > 1:
+		return nil, errors.New("only put/stub can list several files")
+	}
+	return contents[0], nil
+}
+
+// legacyStub builds API v2 stub that matches request bodies containing every
+// matcher and responds with given response
+func legacyStub(matchers [][]byte, response []byte) ([]byte, error) {
+	contains := make([]string, len(matchers))
+	for i, matcher := range matchers {
+		// editors add trailing newline, it is not part of the matcher
+		contains[i] = strings.TrimRight(string(matcher), "\r\n")
+	}
+	return json.Marshal(map[string]interface{}{
+		"request": map[string]interface{}{
+			"method":       "POST",
+			"bodyPatterns": map[string]interface{}{"contains": contains},
+		},
+		"response": map[string]interface{}{
+			"status": http.StatusOK,
+			"body":   string(response),
+		},
+	})
+}
+
+// commandResponseWriter records response of a dispatched command
+type commandResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newCommandResponseWriter() *commandResponseWriter {
+	return &commandResponseWriter{header: make(http.Header), code: http.StatusOK}
+}
+
+func (w *commandResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *commandResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *commandResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
@@ -0,0 +1,43 @@
+package lgc
+
+import (
+	"testing"
+)
+
+func TestParseCommands(t *testing.T) {
+	text := []byte(`# recording
+delete/stubs?scenario=first
+
+begin/session?scenario=first&session=first_1&mode=record
+/stubo/api/put/stub?session=first_1, first.textMatcher, first.response
+end/sessions?scenario=first`)
+	commands, err := parseCommands(text)
+	expect(t, err, nil)
+	expect(t, len(commands), 4)
+
+	expect(t, commands[0].path, "/stubo/api/delete/stubs")
+	expect(t, commands[0].query, "scenario=first")
+	expect(t, commands[0].method(), "GET")
+
+	expect(t, commands[2].path, "/stubo/api/put/stub")
+	expect(t, commands[2].query, "session=first_1")
+	expect(t, len(commands[2].files), 2)
+	expect(t, commands[2].files[0], "first.textMatcher")
+	expect(t, commands[2].files[1], "first.response")
+	expect(t, commands[2].method(), "POST")
+}
+
+func TestResolveCommandsPath(t *testing.T) {
+	path, err := resolveCommandsPath("/commands", "first/first.commands")
+	expect(t, err, nil)
+	expect(t, path, "/commands/first/first.commands")
+
+	_, err = resolveCommandsPath("/commands", "../etc/passwd")
+	refute(t, err, nil)
+
+	_, err = resolveCommandsPath("/commands", "/etc/passwd")
+	refute(t, err, nil)
+
+	_, err = resolveCommandsPath("", "first.commands")
+	refute(t, err, nil)
+}
@@ -0,0 +1,81 @@
+package lgc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rusenask/lgc/stubo"
+)
+
+// Error is a failure that is reported to legacy API clients in legacy Stubo
+// error envelope: {"version": ..., "error": {"code": ..., "message": ...}}
+type Error struct {
+	// Code - response status code
+	Code    int
+	Message string
+	// Version - Stubo version, empty when Stubo was not reached
+	Version string
+	// Err - cause of the failure
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns cause of the failure
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// badRequest returns error for invalid legacy API call
+func badRequest(message string) *Error {
+	return &Error{Code: http.StatusBadRequest, Message: message}
+}
+
+// notFound returns error for legacy API call that refers to unknown object
+func notFound(message string) *Error {
+	return &Error{Code: http.StatusNotFound, Message: message}
+}
+
+// legacyError converts error into legacy error. Stubo error responses keep
+// their status code, message and Stubo version, other failures get status code
+// that describes them (503 when Stubo is unavailable, 504 on timeout, etc.)
+func legacyError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	e = &Error{Code: stubo.StatusCode(err), Message: err.Error(), Err: err}
+	var stuboErr *stubo.Error
+	switch {
+	case errors.As(err, &stuboErr) && stuboErr.Envelope != nil:
+		e.Message = stuboErr.Envelope.Error.Message
+		e.Version = stuboErr.Envelope.Version
+	case errors.As(err, &stuboErr) && stuboErr.StatusCode == http.StatusBadRequest && stuboErr.Err != nil:
+		// invalid request that was not sent to Stubo
+		e.Message = stuboErr.Err.Error()
+	case errors.Is(err, stubo.ErrCircuitOpen):
+		e.Message = stubo.ErrCircuitOpen.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		e.Message = "Timed out waiting for Stubo response."
+	}
+	return e
+}
+
+// writeError writes error to the client in legacy Stubo error envelope
+func writeError(w http.ResponseWriter, err error) {
+	e := legacyError(err)
+	response, _ := json.Marshal(&ErrorToClient{
+		Version: e.Version,
+		Error: ErrorDetails{
+			Code:    e.Code,
+			Message: e.Message,
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Code)
+	w.Write(response)
+}
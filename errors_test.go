@@ -0,0 +1,84 @@
+package lgc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rusenask/lgc/stubo"
+)
+
+func TestValidationErrorEnvelope(t *testing.T) {
+	server, c := testTools(200, `{"version":"1.2.3","data": []}`)
+	defer server.Close()
+	m := setup(*c)
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/stublist", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusBadRequest)
+	expect(t, respRec.Header().Get("Content-Type"), "application/json")
+	var envelope ErrorToClient
+	err = json.Unmarshal(respRec.Body.Bytes(), &envelope)
+	expect(t, err, nil)
+	expect(t, envelope.Error.Code, http.StatusBadRequest)
+	expect(t, envelope.Error.Message, "Scenario name not provided.")
+}
+
+func TestUpstreamErrorEnvelope(t *testing.T) {
+	testData := `{"version": "0.6.6", "error": {"code": 404, "message": "Scenario not found"}}`
+	server, c := testTools(404, testData)
+	defer server.Close()
+	m := setup(*c)
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/stublist?scenario=first", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusNotFound)
+	var envelope ErrorToClient
+	err = json.Unmarshal(respRec.Body.Bytes(), &envelope)
+	expect(t, err, nil)
+	expect(t, envelope.Version, "0.6.6")
+	expect(t, envelope.Error.Code, http.StatusNotFound)
+	expect(t, envelope.Error.Message, "Scenario not found")
+}
+
+func TestLegacyError(t *testing.T) {
+	e := legacyError(&stubo.Error{Op: "GetScenarios", StatusCode: 504, Err: context.DeadlineExceeded})
+	expect(t, e.Code, http.StatusGatewayTimeout)
+	expect(t, e.Message, "Timed out waiting for Stubo response.")
+
+	e = legacyError(&stubo.Error{Op: "GetScenarios", StatusCode: 503, Err: stubo.ErrCircuitOpen})
+	expect(t, e.Code, http.StatusServiceUnavailable)
+	expect(t, e.Message, stubo.ErrCircuitOpen.Error())
+
+	e = legacyError(errors.New("something went wrong"))
+	expect(t, e.Code, http.StatusInternalServerError)
+	expect(t, e.Message, "something went wrong")
+}
+
+func TestUnknownRouteErrorEnvelope(t *testing.T) {
+	server, c := testTools(200, `{"version":"1.2.3","data": []}`)
+	defer server.Close()
+	m := setup(*c)
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/modulelist", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusNotFound)
+	expect(t, respRec.Header().Get("Content-Type"), "application/json")
+	var envelope ErrorToClient
+	err = json.Unmarshal(respRec.Body.Bytes(), &envelope)
+	expect(t, err, nil)
+	expect(t, envelope.Error.Code, http.StatusNotFound)
+	expect(t, envelope.Error.Message, "Unknown API call: /stubo/api/get/modulelist")
+}
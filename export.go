@@ -0,0 +1,178 @@
+package lgc
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rusenask/lgc/stubo"
+)
+
+// stubMeta is used to get metadata fields from stub payload
+type stubMeta struct {
+	Session     string      `json:"session"`
+	DelayPolicy string      `json:"delay_policy"`
+	Module      string      `json:"ext_module"`
+	Stateful    interface{} `json:"stateful"`
+}
+
+// exportFile is a single file in scenario export archive
+type exportFile struct {
+	name string
+	body []byte
+}
+
+// buildExport creates legacy export files - YAML command file and one JSON file
+// per stub. Delay policies are passed as raw API v2 objects keyed by name.
+func buildExport(scenario string, stubs stubo.ScenarioStubsResponse, delayPolicies map[string]map[string]interface{}) []exportFile {
+	var files []exportFile
+	var yaml bytes.Buffer
+
+	fmt.Fprintf(&yaml, "# scenario %s exported by LGC\n", scenario)
+
+	// delay policies must be created before stubs that reference them
+	if len(delayPolicies) > 0 {
+		yaml.WriteString("delay_policy:\n")
+		var names []string
+		for name := range delayPolicies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			policy := delayPolicies[name]
+			var keys []string
+			for key := range policy {
+				// reference is API v2 specific
+				if key != "delayPolicyRef" {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for i, key := range keys {
+				prefix := "    "
+				if i == 0 {
+					prefix = "  - "
+				}
+				fmt.Fprintf(&yaml, "%s%s: %s\n", prefix, key, yamlValue(policy[key]))
+			}
+		}
+	}
+
+	fmt.Fprintf(&yaml, "recording:\n  scenario: %s\n  session: %s\n  stubs:\n",
+		yamlValue(scenario), yamlValue(scenario+"_export"))
+	base := exportName(scenario)
+	for i, stub := range stubs.Data {
+		name := fmt.Sprintf("%s_%d.json", base, i)
+		fmt.Fprintf(&yaml, "  - file: %s\n", yamlValue(name))
+
+		var meta stubMeta
+		if err := json.Unmarshal(stub.Stub, &meta); err == nil && meta.DelayPolicy != "" {
+			fmt.Fprintf(&yaml, "    vars:\n      delay_policy: %s\n", yamlValue(meta.DelayPolicy))
+		}
+		files = append(files, exportFile{name: name, body: stub.Stub})
+	}
+
+	commands := exportFile{name: base + ".yaml", body: yaml.Bytes()}
+	return append([]exportFile{commands}, files...)
+}
+
+// exportName returns scenario name that is safe to use in archive entry and
+// download file names. Scenario names can contain "/" and "..", such names
+// would be extracted outside of target directory, so only letters, digits,
+// "-", "_" and "." are kept, other characters are replaced with "_"
+func exportName(scenario string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.') {
+			return r
+		}
+		return '_'
+	}, scenario)
+	// leading dots would make hidden files or ".." entries
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		return "scenario"
+	}
+	return name
+}
+
+// decodeDelayPolicy gets delay policy object from API v2 response. Policy
+// can be returned either as an object or as a list with single object.
+func decodeDelayPolicy(response []byte) (map[string]interface{}, error) {
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	err := json.Unmarshal(response, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	var policies []map[string]interface{}
+	if err := json.Unmarshal(envelope.Data, &policies); err == nil {
+		if len(policies) == 0 {
+			return nil, errors.New("delay policy not found")
+		}
+		return policies[0], nil
+	}
+	var policy map[string]interface{}
+	err = json.Unmarshal(envelope.Data, &policy)
+	return policy, err
+}
+
+// yamlValue formats scalar value for YAML document. JSON encoded scalars are
+// valid YAML, so strings are always quoted and escaped.
+func yamlValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return `""`
+	}
+	return string(b)
+}
+
+// writeZip writes export files to zip archive
+func writeZip(w io.Writer, files []exportFile) error {
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		header := &zip.FileHeader{Name: file.name, Method: zip.Deflate}
+		header.Modified = time.Now()
+		f, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(file.body); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// writeTarGz writes export files to gzipped tar archive
+func writeTarGz(w io.Writer, files []exportFile) error {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    file.name,
+			Mode:    0644,
+			Size:    int64(len(file.body)),
+			ModTime: time.Now(),
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := archive.Write(file.body); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,56 @@
+package lgc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rusenask/lgc/stubo"
+)
+
+func TestBuildExport(t *testing.T) {
+	stubs := stubo.ScenarioStubsResponse{
+		Data: []stubo.StubDetail{
+			{Stub: json.RawMessage(`{"request": {}, "response": {}, "delay_policy": "slow"}`)},
+			{Stub: json.RawMessage(`{"request": {}, "response": {}}`)},
+		},
+	}
+	delayPolicies := map[string]map[string]interface{}{
+		"slow": {"name": "slow", "delay_type": "fixed", "milliseconds": 1000,
+			"delayPolicyRef": "/stubo/api/v2/delay-policy/objects/slow"},
+	}
+	files := buildExport("first", stubs, delayPolicies)
+	expect(t, len(files), 3)
+	expect(t, files[0].name, "first.yaml")
+	expect(t, files[2].name, "first_1.json")
+
+	yaml := string(files[0].body)
+	expect(t, strings.Contains(yaml, `  - delay_type: "fixed"`), true)
+	expect(t, strings.Contains(yaml, `    milliseconds: 1000`), true)
+	expect(t, strings.Contains(yaml, "delayPolicyRef"), false)
+	expect(t, strings.Contains(yaml, `  - file: "first_0.json"`+"\n"+`    vars:`), true)
+}
+
+func TestExportName(t *testing.T) {
+	expect(t, exportName("first"), "first")
+	expect(t, exportName("../../etc/cron.d"), "_.._etc_cron.d")
+	expect(t, exportName(".."), "scenario")
+	expect(t, exportName(`a"b c`), "a_b_c")
+
+	files := buildExport("../first", stubo.ScenarioStubsResponse{
+		Data: []stubo.StubDetail{{Stub: json.RawMessage(`{"request": {}, "response": {}}`)}},
+	}, nil)
+	expect(t, files[0].name, "_first.yaml")
+	expect(t, files[1].name, "_first_0.json")
+	// commands file keeps real scenario name
+	expect(t, strings.Contains(string(files[0].body), `scenario: "../first"`), true)
+}
+
+func TestDecodeDelayPolicy(t *testing.T) {
+	policy, err := decodeDelayPolicy([]byte(`{"version": "0.6.6", "data": [{"name": "slow", "milliseconds": 50}]}`))
+	expect(t, err, nil)
+	expect(t, policy["name"], "slow")
+
+	_, err = decodeDelayPolicy([]byte(`{"version": "0.6.6", "data": []}`))
+	refute(t, err, nil)
+}
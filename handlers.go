@@ -1,45 +1,151 @@
-package main
+package lgc
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/go-zoo/bone"
+	"github.com/rusenask/lgc/internal/util"
+	"github.com/rusenask/lgc/stubo"
 )
 
-// HandlerHTTPClient is used to inject http.Client to handlers
+// HandlerHTTPClient is used to inject Stubo client to handlers
 type HandlerHTTPClient struct {
-	http Client
+	http         stubo.Client
+	config       Configuration
+	sessions     *SessionRegistry
+	transformers *TransformerRegistry
+	tenants      map[string]*tenantUpstream
 }
 
-// DelayPolicy structure for gettting delay policy references
-type DelayPolicy struct {
-	Name string `json:"name"`
-	Ref  string `json:"delayPolicyRef"`
+// client returns Stubo client for given request. Calls of requests that
+// belong to a tenant go to tenant's Stubo, calls are changed by transformers
+// of legacy route
+func (h HandlerHTTPClient) client(r *http.Request) *stubo.Client {
+	c := h.http
+	c.Transformer = h.transformers.Get(r.URL.Path)
+	if t, ok := tenantUpstreamFromContext(r.Context()); ok {
+		c.StuboURI = t.URI
+		c.Breaker = t.Breaker
+		c.Upstreams = nil
+	}
+	return &c
+}
+
+// logger returns LGC logger
+func (h HandlerHTTPClient) logger() *log.Logger {
+	return util.LoggerOrDefault(h.http.Logger)
 }
 
-// DelayPolicyResponse structure for unmarshaling JSON structures from API v2
-type DelayPolicyResponse struct {
-	Data    []DelayPolicy `json:"data"`
-	Version string        `json:"version"`
+// errorHandler is a handler that returns error instead of writing it to the
+// client. Nothing must be written to the client when error is returned
+type errorHandler func(w http.ResponseWriter, r *http.Request) error
+
+// handle turns errorHandler into http.Handler, returned errors are logged and
+// written to the client in one place
+func (h HandlerHTTPClient) handle(fn errorHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(w, r); err != nil {
+			h.httperror(w, r, err)
+		}
+	})
+}
+
+// writeResponse writes Stubo response to the client, Stubo errors are
+// returned to the caller
+func (h HandlerHTTPClient) writeResponse(w http.ResponseWriter, response *stubo.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.StatusCode)
+	w.Write(response.Body)
+	return nil
+}
+
+// writeJSON encodes v and writes it to the client. Handlers use it instead of
+// writeResponse when Stubo response was decoded and transformed
+func (h HandlerHTTPClient) writeJSON(w http.ResponseWriter, code int, v interface{}) error {
+	response, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(response)
+	return nil
 }
 
-// ResponseToClient is a helper struct for artificially forming responses to clients
+// ResponseToClient is a helper struct for artificially forming responses to
+// clients in legacy Stubo shape: {"version": ..., "data": {"message": ...}}
 type ResponseToClient struct {
-	Version string            `json:"data"`
-	Data    map[string]string `json:"version"`
+	Version string            `json:"version"`
+	Data    map[string]string `json:"data"`
+}
+
+// ErrorDetails holds error code and message for legacy error responses
+type ErrorDetails struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorToClient is a helper struct for forming legacy error responses to clients
+type ErrorToClient struct {
+	Version string       `json:"version"`
+	Error   ErrorDetails `json:"error"`
+}
+
+// StubCountResponse is a legacy API response for get/stubcount
+type StubCountResponse struct {
+	Version string `json:"version"`
+	Data    struct {
+		Count int `json:"count"`
+	} `json:"data"`
+}
+
+// StatusResponse is a legacy API response for get/status
+type StatusResponse struct {
+	Version string `json:"version"`
+	Data    struct {
+		LGCVersion     string                 `json:"lgc_version"`
+		StuboURI       string                 `json:"stubo_uri"`
+		StuboStatus    string                 `json:"stubo_status"`
+		StuboLatency   int64                  `json:"stubo_latency_ms"`
+		Error          string                 `json:"error,omitempty"`
+		ActiveSessions int                    `json:"active_sessions"`
+		Upstreams      []stubo.UpstreamStatus `json:"upstreams,omitempty"`
+	} `json:"data"`
+}
+
+// ExecutedCommandsResponse is a legacy API response for exec/cmds, each
+// command is returned together with its status code
+type ExecutedCommandsResponse struct {
+	Version string `json:"version"`
+	Data    struct {
+		ExecutedCommands struct {
+			Commands [][]interface{} `json:"commands"`
+		} `json:"executed_commands"`
+		NumberOfErrors int `json:"number_of_errors"`
+	} `json:"data"`
 }
 
 // stublistHandler gets stubs, e.g.: stubo/api/get/stublist?scenario=first
-func (h HandlerHTTPClient) stublistHandler(w http.ResponseWriter, r *http.Request) {
+func (h HandlerHTTPClient) stublistHandler(w http.ResponseWriter, r *http.Request) error {
 	scenario, ok := r.URL.Query()["scenario"]
 
 	// setting context logger
-	method := trace()
-	handlersContextLogger := log.WithFields(log.Fields{
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": r.URL.Query(),
 		"url_path":  r.URL.Path,
 		"func":      method,
@@ -48,32 +154,30 @@ func (h HandlerHTTPClient) stublistHandler(w http.ResponseWriter, r *http.Reques
 	if ok {
 		handlersContextLogger.Info("Got query")
 
-		client := h.http
+		client := h.client(r)
 
 		// expecting one param - scenario
-		response, err := client.getScenarioStubs(scenario[0])
-
-		// checking whether we got good response
-		httperror(w, r, err)
-
-		// setting resposne header
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(response)
+		if h.responseMode("get/stublist") == responseLegacy {
+			stubs, err := client.ListScenarioStubs(r.Context(), scenario[0])
+			if err != nil {
+				return err
+			}
+			return h.writeJSON(w, http.StatusOK, translateStubList(scenario[0], stubs))
+		}
+		response, err := client.GetScenarioStubs(r.Context(), scenario[0])
+		return h.writeResponse(w, response, err)
 	} else {
-		// logging error
-		handlersContextLogger.Warn("Scenario name was not provided")
-
-		http.Error(w, "Scenario name not provided.", 400)
+		return badRequest("Scenario name not provided.")
 	}
 }
 
 // deleteStubsHandler deletes scenario stubs, e.g.: stubo/api/delete/stubs?scenario=first
 // optional arguments host=your_host, force=true/false (defaults to false)
-func (h HandlerHTTPClient) deleteStubsHandler(w http.ResponseWriter, r *http.Request) {
+func (h HandlerHTTPClient) deleteStubsHandler(w http.ResponseWriter, r *http.Request) error {
 	scenario, ok := r.URL.Query()["scenario"]
 	// setting context logger
-	method := trace()
-	handlersContextLogger := log.WithFields(log.Fields{
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": r.URL.Query(),
 		"url_path":  r.URL.Path,
 		"func":      method,
@@ -83,181 +187,144 @@ func (h HandlerHTTPClient) deleteStubsHandler(w http.ResponseWriter, r *http.Req
 		handlersContextLogger.Info("Got query")
 
 		// expecting params - scenario, host, force
-		client := h.http
-		var p APIParams
-		p.name = scenario[0]
-		force, ok := r.URL.Query()["force"]
-		if ok {
-			p.force = force[0]
+		client := h.client(r)
+		req := stubo.DeleteStubsRequest{
+			Scenario:   scenario[0],
+			Force:      r.URL.Query().Get("force"),
+			TargetHost: r.URL.Query().Get("host"),
 		}
-		host, ok := r.URL.Query()["host"]
-		if ok {
-			p.targetHost = host[0]
-		}
-		response, code, err := client.deleteScenarioStubs(p)
-		// checking whether we got good response
-		httperror(w, r, err)
-		// setting resposne header
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(code)
-		w.Write(response)
+		response, err := client.DeleteScenarioStubs(r.Context(), req)
+		return h.writeResponse(w, response, err)
 	} else {
 		msg := "Scenario name not provided."
-		handlersContextLogger.Warn(msg)
-		http.Error(w, msg, 400)
+		return badRequest(msg)
 	}
 }
 
 // putStubHandler takes in POST request from client, transforms URL query arguments
 // to header values and calls another function that calls Stubo API v2, returns
 // response bytes without unmarshalling/marshalling them
-func (h HandlerHTTPClient) putStubHandler(w http.ResponseWriter, r *http.Request) {
+func (h HandlerHTTPClient) putStubHandler(w http.ResponseWriter, r *http.Request) error {
 	urlQuery := r.URL.Query()
 	// getting session name
 	session, ok := urlQuery["session"]
-	client := h.http
+	client := h.client(r)
 
 	// setting context logger
-	method := trace()
-	handlersContextLogger := log.WithFields(log.Fields{
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": urlQuery,
 		"url_path":  r.URL.Path,
 		"func":      method,
 	})
 	if ok {
 		// session name is present, moving forward
-		ScenarioSession := session[0]
-		slices := strings.Split(ScenarioSession, ":")
+		slices := h.splitSession(r, session[0])
 		// check whether user has supplied scenario name as well
-		if len(slices) < 2 {
+		if len(slices) != 2 {
 			msg := "Bad request, missing session or scenario name. When under proxy, please use 'scenario:session' format in your" +
 				"URL query, such as '/stubo/api/put/stub?session=scenario:session_name' "
-			handlersContextLogger.Warn(msg)
-			log.Warn(msg)
-			http.Error(w, msg, 400)
-			return
+			return badRequest(msg)
 		}
 		scenario := slices[0]
 
-		// removing session from the MAP
-		delete(urlQuery, "session")
-
-		// these URL query arguments are expected and should be converted to headers
-		expectedHeaders := map[string]bool{
-			"ext_module":        true,
-			"delay_policy":      true,
-			"stateful":          true,
-			"stub_created_date": true,
+		// configured URL query arguments (ext_module, delay_policy, stateful and
+		// stub_created_date by default) are converted to headers, session is
+		// not forwarded
+		headers, args := getURLHeadersArgs(h.headerArgs("put/stub"), r.URL.RawQuery, "session")
+		req := stubo.StubRequest{
+			Scenario: scenario,
+			Session:  slices[1],
+			Args:     args,
+			Headers:  headers,
 		}
-		headers, args := getURLHeadersArgs(expectedHeaders, urlQuery)
-		headers["session"] = slices[1]
+		handlersContextLogger.WithFields(log.Fields{
+			"scenario": scenario,
+		}).Info("Putting stub...")
 
+		if err := h.limitBody(w, r); err != nil {
+			return err
+		}
 		defer r.Body.Close()
-		// reading resposne body
-		body, err := ioutil.ReadAll(r.Body)
-
+		// putting stub, request body is streamed to Stubo
+		resp, err := client.PutStubStream(r.Context(), req, r.Body)
 		if err != nil {
-			// logging read error
-			log.WithFields(log.Fields{
-				"error": err.Error(),
-				"func":  method,
-			}).Warn("Failed to read request body!")
+			return err
 		}
-		// putting stub
-		response, code, err := client.putStub(scenario, args, body, headers)
-		// checking whether we got good response
-		httperror(w, r, err)
-		// setting resposne header
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(code)
-		w.Write(response)
-
+		return h.streamResponse(w, r, resp, "application/json")
 	} else {
 		msg := "Bad request, missing session name."
-		handlersContextLogger.Warn(msg)
-		http.Error(w, msg, 400)
+		return badRequest(msg)
 	}
 }
 
 // getStubResponseHandler checks for existing stub in Stubo based on POST
 // request body payload. Payload can be anything, not only JSON or XML.
-func (h HandlerHTTPClient) getStubResponseHandler(w http.ResponseWriter, r *http.Request) {
+func (h HandlerHTTPClient) getStubResponseHandler(w http.ResponseWriter, r *http.Request) error {
 	urlQuery := r.URL.Query()
 	// getting session name
 	ScenarioSession, ok := getSession(r)
 
-	client := h.http
+	client := h.client(r)
 
 	// setting context logger
-	method := trace()
-	handlersContextLogger := log.WithFields(log.Fields{
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": urlQuery,
 		"url_path":  r.URL.Path,
 		"func":      method,
 	})
 	if ok {
 		// session name is present, moving forward
-		slices := strings.Split(ScenarioSession, ":")
+		slices := h.splitSession(r, ScenarioSession)
 		// check whether user has supplied scenario name as well
-		if len(slices) < 2 {
+		if len(slices) != 2 {
 			msg := "Bad request, missing session or scenario name. When under proxy, please use 'scenario:session' format in your" +
 				"URL query, such as '/stubo/api/get/response?session=scenario:session_name' "
-			handlersContextLogger.Warn(msg)
-			log.Warn(msg)
-			http.Error(w, msg, 400)
-			return
+			return badRequest(msg)
 		}
 		scenario := slices[0]
 
-		// removing session from the MAP
-		delete(urlQuery, "session")
-
-		// these URL query arguments are expected and should be converted to headers
-		expectedHeaders := map[string]bool{}
-		headers, args := getURLHeadersArgs(expectedHeaders, urlQuery)
-		headers["session"] = slices[1]
+		// configured URL query arguments are converted to headers (none by
+		// default), session is not forwarded
+		headers, args := getURLHeadersArgs(h.headerArgs("get/response"), r.URL.RawQuery, "session")
+		req := stubo.StubRequest{
+			Scenario: scenario,
+			Session:  slices[1],
+			Args:     args,
+			Headers:  headers,
+		}
 
-		log.WithFields(log.Fields{
+		handlersContextLogger.WithFields(log.Fields{
 			"headers":  headers,
 			"args":     args,
 			"scenario": scenario,
 		}).Info("Get response Args and Headers created...")
 
+		if err := h.limitBody(w, r); err != nil {
+			return err
+		}
 		defer r.Body.Close()
-		// reading resposne body
-		body, err := ioutil.ReadAll(r.Body)
-
+		// Getting stubo response to request, bodies are streamed both ways
+		resp, err := client.GetResponseStream(r.Context(), req, r.Body)
 		if err != nil {
-			// logging read error
-			log.WithFields(log.Fields{
-				"error": err.Error(),
-				"func":  method,
-			}).Warn("Failed to read request body!")
+			return err
 		}
-		// Getting stubo response to request
-		response, code, err := client.getStubResponse(scenario, args, body, headers)
-		// checking whether we got good response
-		httperror(w, r, err)
-		// setting resposne header
-		w.Header().Set("Content-Type", "text/html")
-		w.WriteHeader(code)
-		w.Write(response)
-
+		return h.streamResponse(w, r, resp, "text/html")
 	} else {
 		msg := "Bad request, missing session name."
-		handlersContextLogger.Warn(msg)
-		http.Error(w, msg, 400)
+		return badRequest(msg)
 	}
 }
 
 // getDelayPolicyHandler - returns delay policy information, list all if
 // name is not provided, e.g.: stubo/api/get/delay_policy?name=slow
-func (h HandlerHTTPClient) getDelayPolicyHandler(w http.ResponseWriter, r *http.Request) {
+func (h HandlerHTTPClient) getDelayPolicyHandler(w http.ResponseWriter, r *http.Request) error {
 	name, ok := r.URL.Query()["name"]
-	client := h.http
+	client := h.client(r)
 	// setting context logger
-	method := trace()
-	handlersContextLogger := log.WithFields(log.Fields{
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": r.URL.Query(),
 		"url_path":  r.URL.Path,
 		"func":      method,
@@ -267,43 +334,33 @@ func (h HandlerHTTPClient) getDelayPolicyHandler(w http.ResponseWriter, r *http.
 
 		handlersContextLogger.Info("Got query")
 		// expecting one param - scenario
-		response, err := client.getDelayPolicy(name[0])
-		// checking whether we got good response
-		httperror(w, r, err)
-		// setting resposne header
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(response)
+		response, err := client.GetDelayPolicy(r.Context(), name[0])
+		return h.writeResponse(w, response, err)
 	} else {
 		// name is not provided, getting all delay policies
-		response, err := client.getAllDelayPolicies()
-		// checking whether we got good response
-		httperror(w, r, err)
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(response)
+		response, err := client.GetDelayPolicies(r.Context())
+		return h.writeResponse(w, response, err)
 	}
 }
 
 // putDelayPolicyHandler takes URL query arguments and turns them into JSON
 // example query: stubo/api/put/delay_policy?name=slow&delay_type=fixed&milliseconds=1000
-func (h HandlerHTTPClient) putDelayPolicyHandler(w http.ResponseWriter, r *http.Request) {
+func (h HandlerHTTPClient) putDelayPolicyHandler(w http.ResponseWriter, r *http.Request) error {
 	urlQuery := r.URL.Query()
-	client := h.http
-	// query MAP stores key/value pairs, although all the values are of array type []
-	newQuery := make(map[string]string)
-	for key, value := range urlQuery {
-		// taking only first argument
-		newQuery[key] = value[0]
+	client := h.client(r)
+	// taking only first argument of every key
+	policy := stubo.DelayPolicyRequest{
+		Name:         urlQuery.Get("name"),
+		DelayType:    urlQuery.Get("delay_type"),
+		Milliseconds: urlQuery.Get("milliseconds"),
+		Mean:         urlQuery.Get("mean"),
+		Stddev:       urlQuery.Get("stddev"),
 	}
 
 	// setting context logger
-	method := trace()
-
-	// converting query MAP to JSON key/value pairs
-	jsonString, err := json.Marshal(newQuery)
-
-	httperror(w, r, err)
+	method := util.Trace()
 
-	handlersContextLogger := log.WithFields(log.Fields{
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": r.URL.Query(),
 		"url_path":  r.URL.Path,
 		"func":      method,
@@ -311,22 +368,19 @@ func (h HandlerHTTPClient) putDelayPolicyHandler(w http.ResponseWriter, r *http.
 
 	handlersContextLogger.Info("Got query to create new delay policy.")
 
-	response, code, err := client.putDelayPolicy(jsonString)
-	httperror(w, r, err)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	w.Write(response)
+	response, err := client.PutDelayPolicy(r.Context(), policy)
+	return h.writeResponse(w, response, err)
 }
 
 // deleteDelayPolicyHandler - deletes delay policy
 // stubo/api/delete/delay_policy?name=slow
-func (h HandlerHTTPClient) deleteDelayPolicyHandler(w http.ResponseWriter, r *http.Request) {
+func (h HandlerHTTPClient) deleteDelayPolicyHandler(w http.ResponseWriter, r *http.Request) error {
 	name, ok := r.URL.Query()["name"]
-	client := h.http
+	client := h.client(r)
 
 	// setting context logger
-	method := trace()
-	handlersContextLogger := log.WithFields(log.Fields{
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": r.URL.Query(),
 		"url_path":  r.URL.Path,
 		"func":      method,
@@ -335,35 +389,36 @@ func (h HandlerHTTPClient) deleteDelayPolicyHandler(w http.ResponseWriter, r *ht
 	if ok {
 		handlersContextLogger.Info("Deleting specified delay policy")
 		// expecting one param - name
-		response, code, err := client.deleteDelayPolicy(name[0])
-		// checking whether we got good response
-		httperror(w, r, err)
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(code)
-		w.Write(response)
+		response, err := client.DeleteDelayPolicy(r.Context(), name[0])
+		return h.writeResponse(w, response, err)
 	} else {
 		handlersContextLogger.Info("Deleting all delay policies in two steps")
-		delayPolicies, err := client.getAllDelayPolicies()
-		httperror(w, r, err)
-		if err == nil {
-			handlersContextLogger.Info("Got all delay policies, deleting one by one")
-			response, err := client.deleteAllDelayPolicies(delayPolicies)
-			httperror(w, r, err)
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(response)
+		// all calls together are bounded by bulk timeout
+		ctx, cancel := context.WithTimeout(r.Context(), util.Duration(h.config.Timeouts.BulkMs, defaultBulkTimeout))
+		defer cancel()
+		delayPolicies, err := client.GetDelayPolicies(ctx)
+		if err != nil {
+			return err
 		}
+		handlersContextLogger.Info("Got all delay policies, deleting one by one")
+		response, err := h.deleteAllDelayPolicies(ctx, client, delayPolicies.Body)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+		return nil
 	}
 }
 
 // begin/session (GET, POST)
 // stubo/api/begin/session?scenario=first&session=first_1&mode=playback
-func (h HandlerHTTPClient) beginSessionHandler(w http.ResponseWriter, r *http.Request) {
+func (h HandlerHTTPClient) beginSessionHandler(w http.ResponseWriter, r *http.Request) error {
 	queryArgs, _ := url.ParseQuery(r.URL.RawQuery)
 
 	// setting context logger
-	method := trace()
-	handlersContextLogger := log.WithFields(log.Fields{
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": queryArgs,
 		"url_path":  r.URL.Path,
 		"func":      method,
@@ -375,38 +430,48 @@ func (h HandlerHTTPClient) beginSessionHandler(w http.ResponseWriter, r *http.Re
 		if session, ok := queryArgs["session"]; ok {
 			if mode, ok := queryArgs["mode"]; ok {
 				// Create scenario. This can result in 422 (duplicate error) and this is
-				// fine, since we must only ensure that it exists.
-				client := h.http
-				_, _, err := client.createScenario(scenario[0])
-				httperror(w, r, err)
+				// fine, since we must only ensure that it exists. Any other failure
+				// aborts session begin.
+				client := h.client(r)
+				_, err := client.CreateScenario(r.Context(), scenario[0])
+				if err != nil && stubo.StatusCode(err) != http.StatusUnprocessableEntity {
+					return err
+				}
 				// Begin session
-				response, code, err := client.beginSession(session[0], scenario[0], mode[0])
-				httperror(w, r, err)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(code)
-				w.Write(response)
+				req := stubo.SessionRequest{Scenario: scenario[0], Session: session[0], Mode: mode[0]}
+				if h.responseMode("begin/session") == responseLegacy {
+					status, err := client.BeginSessionStatus(r.Context(), req)
+					if err != nil {
+						return err
+					}
+					h.sessions.Add(requestTenant(r), session[0], scenario[0], mode[0])
+					return h.writeJSON(w, http.StatusOK, translateSession(status))
+				}
+				response, err := client.BeginSession(r.Context(), req)
+				if err == nil {
+					// remembering session owner for end/session calls
+					h.sessions.Add(requestTenant(r), session[0], scenario[0], mode[0])
+				}
+				return h.writeResponse(w, response, err)
 			} else {
 				msg := "Bad request, missing session mode key."
-				handlersContextLogger.Warn(msg)
-				http.Error(w, msg, 400)
+				return badRequest(msg)
 			}
 		} else {
 			msg := "Bad request, missing session name."
-			handlersContextLogger.Warn(msg)
-			http.Error(w, msg, 400)
+			return badRequest(msg)
 		}
 	} else {
 		msg := "Bad request, missing scenario name."
-		handlersContextLogger.Warn(msg)
-		http.Error(w, msg, 400)
+		return badRequest(msg)
 	}
 }
 
-func (h HandlerHTTPClient) endSessionsHandler(w http.ResponseWriter, r *http.Request) {
+func (h HandlerHTTPClient) endSessionsHandler(w http.ResponseWriter, r *http.Request) error {
 
 	// setting context logger
-	method := trace()
-	handlersContextLogger := log.WithFields(log.Fields{
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": r.URL.Query(),
 		"url_path":  r.URL.Path,
 		"func":      method,
@@ -415,37 +480,439 @@ func (h HandlerHTTPClient) endSessionsHandler(w http.ResponseWriter, r *http.Req
 	if ok {
 		handlersContextLogger.Info("Ending session...")
 		// expecting one param - scenario
-		client := h.http
-		response, code, err := client.endSessions(scenario[0])
-		// checking whether we got good response
-		httperror(w, r, err)
-		// setting resposne header
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(code)
-		w.Write(response)
+		client := h.client(r)
+		response, err := client.EndSessions(r.Context(), scenario[0])
+		if err == nil {
+			h.sessions.RemoveScenario(requestTenant(r), scenario[0])
+		}
+		return h.writeResponse(w, response, err)
 	} else {
 		msg := "Scenario name not provided."
-		handlersContextLogger.Warn(msg)
-		http.Error(w, msg, 400)
+		return badRequest(msg)
+	}
+}
+
+// endSessionHandler ends specified session, e.g.: stubo/api/end/session?session=first_1
+// API v2 requires scenario name to end session, so it is taken from session
+// registry (populated during begin/session) or looked up in scenario details
+func (h HandlerHTTPClient) endSessionHandler(w http.ResponseWriter, r *http.Request) error {
+	// setting context logger
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
+		"url_query": r.URL.Query(),
+		"url_path":  r.URL.Path,
+		"func":      method,
+	})
+	session, ok := r.URL.Query()["session"]
+	if !ok {
+		msg := "Session name not provided."
+		return badRequest(msg)
 	}
+	client := h.client(r)
+
+	var scenario string
+	if info, ok := h.sessions.Get(requestTenant(r), session[0]); ok {
+		scenario = info.Scenario
+	} else {
+		handlersContextLogger.Info("Session not found in registry, looking it up in scenario details")
+		details, err := client.ListScenariosDetail(r.Context())
+		if err != nil {
+			return err
+		}
+		scenario, ok = findSessionScenario(*details, session[0])
+		if !ok {
+			msg := "Session '" + session[0] + "' not found in any scenario."
+			return notFound(msg)
+		}
+	}
+
+	handlersContextLogger.WithFields(log.Fields{
+		"scenario": scenario,
+	}).Info("Ending session...")
+	response, err := client.EndSession(r.Context(), stubo.SessionRequest{Scenario: scenario, Session: session[0]})
+	if err == nil || stubo.StatusCode(err) == http.StatusNotFound {
+		h.sessions.Remove(requestTenant(r), session[0])
+	}
+	return h.writeResponse(w, response, err)
 }
 
-func (h HandlerHTTPClient) getScenariosHandler(w http.ResponseWriter, r *http.Request) {
-	client := h.http
+// exportHandler exports scenario stubs and delay policies as an archive with
+// legacy YAML command file and stub JSON files, e.g.: stubo/api/get/export?scenario=first
+// optional argument format=zip/tar.gz (defaults to zip)
+func (h HandlerHTTPClient) exportHandler(w http.ResponseWriter, r *http.Request) error {
+	// setting context logger
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
+		"url_query": r.URL.Query(),
+		"url_path":  r.URL.Path,
+		"func":      method,
+	})
+	scenario, ok := r.URL.Query()["scenario"]
+	if !ok {
+		msg := "Scenario name not provided."
+		return badRequest(msg)
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "tar.gz" {
+		msg := "Unknown export format '" + format + "', use 'zip' or 'tar.gz'."
+		return badRequest(msg)
+	}
+	client := h.client(r)
+
+	handlersContextLogger.Info("Exporting scenario...")
+	stubs, err := client.ListScenarioStubs(r.Context(), scenario[0])
+	if err != nil {
+		return err
+	}
+
+	// getting delay policies referenced by stubs
+	delayPolicies := make(map[string]map[string]interface{})
+	for _, stub := range stubs.Data {
+		var meta stubMeta
+		if json.Unmarshal(stub.Stub, &meta) != nil || meta.DelayPolicy == "" {
+			continue
+		}
+		if _, ok := delayPolicies[meta.DelayPolicy]; ok {
+			continue
+		}
+		dp, err := client.GetDelayPolicy(r.Context(), meta.DelayPolicy)
+		if err == nil {
+			var policy map[string]interface{}
+			policy, err = decodeDelayPolicy(dp.Body)
+			if err == nil {
+				delayPolicies[meta.DelayPolicy] = policy
+				continue
+			}
+		}
+		handlersContextLogger.WithFields(log.Fields{
+			"delay_policy": meta.DelayPolicy,
+			"error":        err.Error(),
+		}).Warn("Failed to get delay policy, skipping it")
+	}
+
+	files := buildExport(scenario[0], *stubs, delayPolicies)
+
+	var archive bytes.Buffer
+	contentType := "application/zip"
+	if format == "zip" {
+		err = writeZip(&archive, files)
+	} else {
+		contentType = "application/gzip"
+		err = writeTarGz(&archive, files)
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": exportName(scenario[0]) + "." + format,
+	}))
+	w.Write(archive.Bytes())
+	return nil
+}
+
+// stubCountHandler counts stubs, e.g.: stubo/api/get/stubcount?scenario=first
+// when scenario is not provided - stubs in all scenarios are counted. Optional
+// argument host=your_host limits counting to scenarios of that host
+func (h HandlerHTTPClient) stubCountHandler(w http.ResponseWriter, r *http.Request) error {
+	// setting context logger
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
+		"url_query": r.URL.Query(),
+		"url_path":  r.URL.Path,
+		"func":      method,
+	})
+	client := h.client(r)
+	host := r.URL.Query().Get("host")
+
+	var scenarios []string
+	var version string
+	if scenario := r.URL.Query().Get("scenario"); scenario != "" {
+		if host != "" && !strings.Contains(scenario, ":") {
+			scenario = host + ":" + scenario
+		}
+		scenarios = append(scenarios, scenario)
+	} else {
+		handlersContextLogger.Info("Scenario not provided, counting stubs in all scenarios")
+		all, err := client.ListScenarios(r.Context())
+		if err != nil {
+			return err
+		}
+		version = all.Version
+		for _, scenario := range all.Data {
+			if host == "" || strings.HasPrefix(scenario.Name, host+":") {
+				scenarios = append(scenarios, scenario.Name)
+			}
+		}
+	}
+
+	var count StubCountResponse
+	for _, scenario := range scenarios {
+		stubs, err := client.ListScenarioStubs(r.Context(), scenario)
+		if err != nil {
+			return err
+		}
+		if version == "" {
+			version = stubs.Version
+		}
+		count.Data.Count += len(stubs.Data)
+	}
+	count.Version = version
+
+	handlersContextLogger.WithFields(log.Fields{
+		"scenarios": len(scenarios),
+		"count":     count.Data.Count,
+	}).Info("Stubs counted")
+
+	return h.writeJSON(w, http.StatusOK, count)
+}
+
+// renameScenarioHandler renames scenario, e.g.: stubo/api/put/scenarios/first?new_name=second
+// (scenario name can also be supplied as scenario=first argument). API v2 does
+// not support renaming, so new scenario is created and all stubs are copied into it
+func (h HandlerHTTPClient) renameScenarioHandler(w http.ResponseWriter, r *http.Request) error {
+	// setting context logger
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
+		"url_query": r.URL.Query(),
+		"url_path":  r.URL.Path,
+		"func":      method,
+	})
+	scenario := bone.GetValue(r, "scenario")
+	if scenario == "" {
+		scenario = r.URL.Query().Get("scenario")
+	}
+	newName := r.URL.Query().Get("new_name")
+	if scenario == "" || newName == "" {
+		msg := "Bad request, scenario name and new_name must be provided."
+		return badRequest(msg)
+	}
+	client := h.client(r)
+
+	handlersContextLogger.Info("Renaming scenario...")
+	result, code, err := renameScenario(r.Context(), client, scenario, newName)
+
+	if err != nil {
+		handlersContextLogger.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Warn("Failed to rename scenario")
+		return &Error{
+			Code:    code,
+			Message: "Failed to rename scenario '" + scenario + "' to '" + newName + "': " + err.Error(),
+			Version: result.version,
+			Err:     err,
+		}
+	}
+	message := fmt.Sprintf("Successfully renamed scenario %s to %s, %d stubs moved", scenario, newName, result.stubs)
+	return h.writeJSON(w, code, &ResponseToClient{
+		Version: result.version,
+		Data:    map[string]string{"message": message},
+	})
+}
+
+// getVersionHandler returns LGC and Stubo versions, e.g.: stubo/api/get/version
+// this call is answered by LGC since it is not present in API v2
+func (h HandlerHTTPClient) getVersionHandler(w http.ResponseWriter, r *http.Request) error {
+	client := h.client(r)
 
 	// setting logger
-	method := trace()
-	log.WithFields(log.Fields{
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
 		"url_query": r.URL.Query(),
 		"url_path":  r.URL.Path,
 		"func":      method,
-	}).Info("Getting scenarios")
+	})
+	handlersContextLogger.Info("Getting version")
 
-	response, err := client.getScenarios()
-	// checking whether we got good response
-	httperror(w, r, err)
-	// setting resposne header
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(response)
+	version, err := client.GetVersion(r.Context())
+	if err != nil {
+		return err
+	}
+	return h.writeJSON(w, http.StatusOK, &ResponseToClient{
+		Version: version,
+		Data: map[string]string{
+			"lgc_version":   Version,
+			"stubo_version": version,
+		},
+	})
+}
+
+// getStatusHandler checks whether Stubo is reachable, e.g.: stubo/api/get/status
+// responds with 503 status code when it is not
+func (h HandlerHTTPClient) getStatusHandler(w http.ResponseWriter, r *http.Request) error {
+	client := h.client(r)
+
+	// setting logger
+	method := util.Trace()
+	handlersContextLogger := h.logger().WithFields(log.Fields{
+		"url_query": r.URL.Query(),
+		"url_path":  r.URL.Path,
+		"func":      method,
+	})
+
+	var status StatusResponse
+	start := time.Now()
+	version, err := client.GetVersion(r.Context())
+	latency := time.Since(start)
+	status.Version = version
+	status.Data.LGCVersion = Version
+	status.Data.StuboURI = client.StuboURI
+	status.Data.StuboLatency = int64(latency / time.Millisecond)
+	status.Data.ActiveSessions = h.sessions.Len()
+	if client.Upstreams != nil {
+		status.Data.Upstreams = client.Upstreams.Status()
+	}
+
+	code := http.StatusOK
+	if err != nil {
+		handlersContextLogger.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Warn("Stubo is not reachable")
+		status.Data.StuboStatus = "unreachable"
+		status.Data.Error = err.Error()
+		code = http.StatusServiceUnavailable
+	} else {
+		status.Data.StuboStatus = "ok"
+	}
+
+	return h.writeJSON(w, code, &status)
+}
+
+// execCmdsHandler executes legacy commands file, e.g.: stubo/api/exec/cmds?cmdfile=first.commands
+// commands file can also be uploaded as request body. Every command is dispatched
+// through the given router, just like it was called by the client.
+func (h HandlerHTTPClient) execCmdsHandler(mux http.Handler) errorHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		// setting context logger
+		method := util.Trace()
+		handlersContextLogger := h.logger().WithFields(log.Fields{
+			"url_query": r.URL.Query(),
+			"url_path":  r.URL.Path,
+			"func":      method,
+		})
+
+		// files referenced by commands are looked up in commands directory
+		// or next to commands file
+		dir := h.config.CommandsDir
+		var text []byte
+		var err error
+		if cmdfile := r.URL.Query().Get("cmdfile"); cmdfile != "" {
+			var path string
+			path, err = resolveCommandsPath(h.config.CommandsDir, cmdfile)
+			if err != nil {
+				return badRequest(err.Error())
+			}
+			dir = filepath.Dir(path)
+			text, err = ioutil.ReadFile(path)
+		} else {
+			defer r.Body.Close()
+			text, err = ioutil.ReadAll(r.Body)
+		}
+		if err != nil {
+			return err
+		}
+		commands, err := parseCommands(text)
+		if err != nil || len(commands) == 0 {
+			msg := "Bad request, commands file not provided or empty."
+			return badRequest(msg)
+		}
+
+		var result ExecutedCommandsResponse
+		result.Data.ExecutedCommands.Commands = [][]interface{}{}
+		for _, c := range commands {
+			code := http.StatusBadRequest
+			if c.path == r.URL.Path {
+				handlersContextLogger.Warn("Nested exec/cmds call skipped")
+			} else {
+				body, err := commandBody(dir, c)
+				if err != nil {
+					handlersContextLogger.WithFields(log.Fields{
+						"command": c.line,
+						"error":   err.Error(),
+					}).Warn("Failed to read command files")
+				} else {
+					req, err := http.NewRequestWithContext(r.Context(), c.method(), c.path+"?"+c.query, bytes.NewReader(body))
+					if err == nil {
+						rec := newCommandResponseWriter()
+						mux.ServeHTTP(rec, req)
+						code = rec.code
+
+						// taking Stubo version from the first response that has it
+						if result.Version == "" {
+							var envelope struct {
+								Version string `json:"version"`
+							}
+							if json.Unmarshal(rec.body.Bytes(), &envelope) == nil {
+								result.Version = envelope.Version
+							}
+						}
+					}
+				}
+			}
+			if code >= 300 {
+				result.Data.NumberOfErrors++
+			}
+			handlersContextLogger.WithFields(log.Fields{
+				"command":     c.line,
+				"status_code": code,
+			}).Info("Command executed")
+			result.Data.ExecutedCommands.Commands = append(result.Data.ExecutedCommands.Commands, []interface{}{c.line, code})
+		}
 
+		return h.writeJSON(w, http.StatusOK, &result)
+	}
+}
+
+// circuitBreakerHandler returns Stubo circuit breaker state, e.g.: lgc/admin/circuit_breaker,
+// state of tenant's breaker is returned for tenant's requests or when tenant is
+// given: lgc/admin/circuit_breaker?tenant=team-a
+func (h HandlerHTTPClient) circuitBreakerHandler(w http.ResponseWriter, r *http.Request) error {
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		return h.writeJSON(w, http.StatusOK, h.client(r).Breaker.Status())
+	}
+	upstream, ok := h.tenants[tenant]
+	if !ok {
+		return notFound("Unknown tenant: " + tenant)
+	}
+	return h.writeJSON(w, http.StatusOK, upstream.Breaker.Status())
+}
+
+// notFoundHandler answers calls that are not translated by LGC
+func (h HandlerHTTPClient) notFoundHandler(w http.ResponseWriter, r *http.Request) error {
+	return notFound("Unknown API call: " + r.URL.Path)
+}
+
+// upstreamsHandler returns state of Stubo nodes, e.g.: lgc/admin/upstreams
+func (h HandlerHTTPClient) upstreamsHandler(w http.ResponseWriter, r *http.Request) error {
+	statuses := []stubo.UpstreamStatus{{URI: h.http.StuboURI, Healthy: true}}
+	if h.http.Upstreams != nil {
+		statuses = h.http.Upstreams.Status()
+	}
+	return h.writeJSON(w, http.StatusOK, statuses)
+}
+
+func (h HandlerHTTPClient) getScenariosHandler(w http.ResponseWriter, r *http.Request) error {
+	client := h.client(r)
+
+	// setting logger
+	method := util.Trace()
+	h.logger().WithFields(log.Fields{
+		"url_query": r.URL.Query(),
+		"url_path":  r.URL.Path,
+		"func":      method,
+	}).Info("Getting scenarios")
+
+	if h.responseMode("get/scenarios") == responseLegacy {
+		scenarios, err := client.ListScenarios(r.Context())
+		if err != nil {
+			return err
+		}
+		return h.writeJSON(w, http.StatusOK, translateScenarios(r.URL.Query().Get("host"), scenarios))
+	}
+	response, err := client.GetScenarios(r.Context())
+	return h.writeResponse(w, response, err)
 }
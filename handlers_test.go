@@ -1,19 +1,41 @@
-package main
+package lgc
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/go-zoo/bone"
+	"github.com/rusenask/lgc/stubo"
 )
 
-func setup(c Client) *bone.Mux {
-	//mux router with added routes
-	m := getRouter(HandlerHTTPClient{c})
+func setup(c stubo.Client) *bone.Mux {
+	return setupConfig(c, Configuration{})
+}
 
+// setupConfig returns router for given LGC configuration
+func setupConfig(c stubo.Client, config Configuration) *bone.Mux {
+	//mux router with added routes
+	m, err := getRouter(HandlerHTTPClient{
+		http:     c,
+		config:   config,
+		sessions: NewSessionRegistry(defaultSessionTTL),
+		tenants:  newTenantUpstreams(config.Tenants, config.CircuitBreaker, log.StandardLogger()),
+	})
+	if err != nil {
+		panic(err)
+	}
 	return m
 }
 
@@ -162,6 +184,25 @@ func TestPutStubsHandlerNoScenario(t *testing.T) {
 	expect(t, respRec.Code, http.StatusBadRequest)
 }
 
+func TestPutStubsHandlerExtraColons(t *testing.T) {
+	testData := `inserted`
+	server, c := testTools(201, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", "/stubo/api/put/stub?session=scenario:session:extra", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusBadRequest)
+}
+
 func TestPutStubsHandlerMultipleHeaders(t *testing.T) {
 	testData := `inserted`
 	server, c := testTools(201, testData)
@@ -283,6 +324,28 @@ func TestDeleteDelayPolicyHandler(t *testing.T) {
 	expect(t, respRec.Code, http.StatusOK)
 }
 
+func TestDeleteAllDelayPoliciesHandlerBulkTimeout(t *testing.T) {
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`{"version": "0.6.6", "data": [{"name": "first"}, {"name": "second"}, {"name": "third"}]}`))
+			return
+		}
+		time.Sleep(40 * time.Millisecond)
+		w.Write([]byte(`{"version": "0.6.6", "data": {"message": "deleted"}}`))
+	})
+	m := setupConfig(*c, Configuration{Timeouts: TimeoutsConfig{BulkMs: 60}})
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/delete/delay_policy", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	// deleting all policies takes longer than bulk timeout
+	expect(t, respRec.Code, http.StatusGatewayTimeout)
+}
+
 func TestDeleteAllDelayPoliciesHandler(t *testing.T) {
 	testData := `{"version": "0.6.6",
 																 "data": [
@@ -397,6 +460,60 @@ func TestBeginSessionHandlerMissingMode(t *testing.T) {
 	expect(t, respRec.Code, http.StatusBadRequest)
 }
 
+// TestBeginSessionHandlerScenarioExists - scenario that already exists (422
+// from Stubo) is not a failure, session is started
+func TestBeginSessionHandlerScenarioExists(t *testing.T) {
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && r.URL.Path == "/stubo/api/v2/scenarios" {
+			w.WriteHeader(422)
+			w.Write([]byte(`{"version": "0.6.6", "error": {"code": 422, "message": "Scenario already exists"}}`))
+			return
+		}
+		w.Write([]byte(`{"version": "0.6.6", "data": {"status": "record"}}`))
+	})
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/begin/session?scenario=scenario_x&session=session_x&mode=record", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, strings.Contains(respRec.Body.String(), `"status": "record"`), true)
+}
+
+// TestBeginSessionHandlerCreateScenarioFails - failure to create scenario
+// aborts session begin and only error response is written
+func TestBeginSessionHandlerCreateScenarioFails(t *testing.T) {
+	began := false
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && r.URL.Path == "/stubo/api/v2/scenarios" {
+			w.WriteHeader(500)
+			w.Write([]byte(`{"version": "0.6.6", "error": {"code": 500, "message": "Database is down"}}`))
+			return
+		}
+		began = true
+		w.Write([]byte(`{"version": "0.6.6", "data": {"status": "record"}}`))
+	})
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/begin/session?scenario=scenario_x&session=session_x&mode=record", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusInternalServerError)
+	expect(t, began, false)
+	var envelope ErrorToClient
+	err = json.Unmarshal(respRec.Body.Bytes(), &envelope)
+	expect(t, err, nil)
+	expect(t, envelope.Error.Message, "Database is down")
+}
+
 func TestEndSessionsHandler(t *testing.T) {
 	testData := `begin session`
 	server, c := testTools(200, testData)
@@ -550,3 +667,659 @@ func TestGetStubResponseHanderWithStatusCode(t *testing.T) {
 
 	expect(t, respRec.Code, 123123)
 }
+
+func TestEndSessionHandlerRegisteredSession(t *testing.T) {
+	testData := `end session`
+	server, c := testTools(200, testData)
+	h := HandlerHTTPClient{http: *c, sessions: NewSessionRegistry(defaultSessionTTL)}
+	m, _ := getRouter(h)
+
+	defer server.Close()
+
+	h.sessions.Add("", "registered_session", "scenario_x", "record")
+
+	req, err := http.NewRequest("GET", "/stubo/api/end/session?session=registered_session", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	_, ok := h.sessions.Get("", "registered_session")
+	expect(t, ok, false)
+}
+
+func TestEndSessionHandlerLookupScenario(t *testing.T) {
+	testData := `{"version": "0.6.6",
+		"data": [{"name": "localhost:scenario_x",
+		          "scenarioRef": "/stubo/api/v2/scenarios/objects/localhost:scenario_x",
+		          "sessions": [{"name": "session_x", "status": "playback"}]}]}`
+	var endPath string
+	var endBody map[string]interface{}
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			endPath = r.URL.EscapedPath()
+			json.NewDecoder(r.Body).Decode(&endBody)
+		}
+		fmt.Fprintln(w, testData)
+	})
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/end/session?session=session_x", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	// session is ended in scenario of its host
+	expect(t, endPath, "/stubo/api/v2/scenarios/objects/localhost:scenario_x/action")
+	expect(t, endBody["session"], "session_x")
+	_, ok := endBody["end"]
+	expect(t, ok, true)
+}
+
+func TestEndSessionHandlerUnknownSession(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": []}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/end/session?session=unknown", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusNotFound)
+}
+
+func TestEndSessionHandlerMissingSession(t *testing.T) {
+	testData := ``
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/end/session", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusBadRequest)
+}
+
+func TestExportHandler(t *testing.T) {
+	testData := `{"version": "0.6.6",
+		"data": [{"stub": {"request": {"method": "POST", "bodyPatterns": {"contains": ["get"]}},
+		                   "response": {"status": 200, "body": "<response/>"}}}]}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/export?scenario=scenario_x", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, respRec.Header().Get("Content-Type"), "application/zip")
+
+	body := respRec.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	expect(t, err, nil)
+	expect(t, len(archive.File), 2)
+	expect(t, archive.File[0].Name, "scenario_x.yaml")
+	expect(t, archive.File[1].Name, "scenario_x_0.json")
+}
+
+func TestExportHandlerUnsafeScenarioName(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": [{"stub": {"request": {}, "response": {}}}]}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/export?scenario="+url.QueryEscape(`../x"y`), nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, respRec.Header().Get("Content-Disposition"), `attachment; filename=_x_y.zip`)
+	body := respRec.Body.Bytes()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	expect(t, err, nil)
+	for _, file := range archive.File {
+		expect(t, strings.Contains(file.Name, "/"), false)
+	}
+}
+
+func TestExportHandlerMissingScenario(t *testing.T) {
+	testData := ``
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/export", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusBadRequest)
+}
+
+func TestStubCountHandler(t *testing.T) {
+	testData := `{"version": "0.6.6",
+		"data": [{"stub": {"request": {}, "response": {}}},
+		         {"stub": {"request": {}, "response": {}}}]}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/stubcount?scenario=scenario_x", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+	// reading resposne body
+	body, err := ioutil.ReadAll(respRec.Body)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, string(body), `{"version":"0.6.6","data":{"count":2}}`)
+}
+
+func TestStubCountHandlerAllScenarios(t *testing.T) {
+	// same response is returned for scenario list and scenario stubs calls,
+	// so there are two scenarios with two "stubs" each
+	testData := `{"version": "0.6.6",
+		"data": [{"name": "localhost:scenario_1", "stub": {}},
+		         {"name": "otherhost:scenario_2", "stub": {}}]}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/stubcount", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+	// reading resposne body
+	body, err := ioutil.ReadAll(respRec.Body)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, string(body), `{"version":"0.6.6","data":{"count":4}}`)
+
+	// filtering by host
+	req, err = http.NewRequest("GET", "/stubo/api/get/stubcount?host=localhost", nil)
+	expect(t, err, nil)
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+	body, err = ioutil.ReadAll(respRec.Body)
+
+	expect(t, string(body), `{"version":"0.6.6","data":{"count":2}}`)
+}
+
+func TestRenameScenarioHandler(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": [{"stub": {"request": {}, "response": {}}}]}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/put/scenarios/first?new_name=second", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+	// reading resposne body
+	body, err := ioutil.ReadAll(respRec.Body)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, strings.Contains(string(body), "Successfully renamed scenario first to second"), true)
+}
+
+func TestRenameScenarioHandlerMissingNewName(t *testing.T) {
+	testData := ``
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/put/scenarios?scenario=first", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusBadRequest)
+}
+
+func TestGetVersionHandler(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": []}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/version", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+	// reading resposne body
+	body, err := ioutil.ReadAll(respRec.Body)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, string(body), `{"version":"0.6.6","data":{"lgc_version":"dev","stubo_version":"0.6.6"}}`)
+}
+
+func TestGetStatusHandler(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": []}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/status", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+	// reading resposne body
+	body, err := ioutil.ReadAll(respRec.Body)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, strings.Contains(string(body), `"stubo_status":"ok"`), true)
+}
+
+func TestGetStatusHandlerUnreachable(t *testing.T) {
+	testData := ``
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	// closing server so Stubo is not reachable
+	server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/status", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+	// reading resposne body
+	body, err := ioutil.ReadAll(respRec.Body)
+
+	expect(t, respRec.Code, http.StatusServiceUnavailable)
+	expect(t, strings.Contains(string(body), `"stubo_status":"unreachable"`), true)
+}
+
+func TestExecCmdsHandler(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": {"message": "ok"}}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	commands := `begin/session?scenario=first&session=first_1&mode=record
+put/stub?session=first:first_1
+get/stublist
+end/sessions?scenario=first`
+	req, err := http.NewRequest("POST", "/stubo/api/exec/cmds", strings.NewReader(commands))
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+	// reading resposne body
+	body, err := ioutil.ReadAll(respRec.Body)
+
+	expect(t, respRec.Code, http.StatusOK)
+
+	var result ExecutedCommandsResponse
+	err = json.Unmarshal(body, &result)
+	expect(t, err, nil)
+	expect(t, result.Version, "0.6.6")
+	expect(t, len(result.Data.ExecutedCommands.Commands), 4)
+	expect(t, result.Data.ExecutedCommands.Commands[0][0], "begin/session?scenario=first&session=first_1&mode=record")
+	expect(t, result.Data.ExecutedCommands.Commands[0][1], float64(200))
+	// get/stublist without scenario fails
+	expect(t, result.Data.ExecutedCommands.Commands[2][1], float64(400))
+	expect(t, result.Data.NumberOfErrors, 1)
+}
+
+func TestExecCmdsHandlerCmdFile(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": {"message": "ok"}}`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "commands")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "first.commands"), []byte("put/stub?session=first:first_1,first.textMatcher,first.response"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "first.textMatcher"), []byte("get my stub"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "first.response"), []byte("Hello {{1+1}} World"), 0644)
+
+	m = setupConfig(*c, Configuration{CommandsDir: dir})
+
+	req, err := http.NewRequest("GET", "/stubo/api/exec/cmds?cmdfile=first.commands", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+	// reading resposne body
+	body, err := ioutil.ReadAll(respRec.Body)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, strings.Contains(string(body), `"number_of_errors":0`), true)
+
+	// file outside of commands directory
+	req, err = http.NewRequest("GET", "/stubo/api/exec/cmds?cmdfile=../first.commands", nil)
+	expect(t, err, nil)
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusBadRequest)
+}
+
+// TestExecCmdsHandlerLegacyFormat replays commands file in legacy Stubo format
+// from testdata: plain session names and matcher/response file pairs
+func TestExecCmdsHandlerLegacyFormat(t *testing.T) {
+	var stubs []map[string]interface{}
+	var stubSessions []string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/stubs") {
+			var stub map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&stub)
+			stubs = append(stubs, stub)
+			stubSessions = append(stubSessions, r.URL.Path+" "+r.Header.Get("session"))
+		}
+		w.Write([]byte(`{"version": "0.6.6", "data": {"message": "ok"}}`))
+	})
+	defer server.Close()
+	m := setupConfig(*c, Configuration{CommandsDir: "testdata/commands"})
+
+	req, err := http.NewRequest("GET", "/stubo/api/exec/cmds?cmdfile=first.commands", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	var result ExecutedCommandsResponse
+	err = json.Unmarshal(respRec.Body.Bytes(), &result)
+	expect(t, err, nil)
+	expect(t, result.Data.NumberOfErrors, 0)
+
+	expect(t, len(stubs), 2)
+	expect(t, stubSessions[0], "/stubo/api/v2/scenarios/objects/first/stubs first_1")
+	request := stubs[0]["request"].(map[string]interface{})
+	patterns := request["bodyPatterns"].(map[string]interface{})
+	expect(t, fmt.Sprint(patterns["contains"]), "[get my stub]")
+	response := stubs[0]["response"].(map[string]interface{})
+	expect(t, response["body"], "Hello World\n")
+	expect(t, response["status"], float64(200))
+	// several matchers
+	patterns = stubs[1]["request"].(map[string]interface{})["bodyPatterns"].(map[string]interface{})
+	expect(t, fmt.Sprint(patterns["contains"]), "[get my stub and this one]")
+}
+
+// TestExecCmdsHandlerLegacyPlayback replays get/response with plain session
+// name from testdata commands file
+func TestExecCmdsHandlerLegacyPlayback(t *testing.T) {
+	var responseCall, responseBody string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/stubs") {
+			body, _ := ioutil.ReadAll(r.Body)
+			responseCall = r.URL.Path + " " + r.Header.Get("session")
+			responseBody = string(body)
+		}
+		w.Write([]byte(`{"version": "0.6.6", "data": {"message": "ok"}}`))
+	})
+	defer server.Close()
+	m := setupConfig(*c, Configuration{CommandsDir: "testdata/commands"})
+
+	req, err := http.NewRequest("GET", "/stubo/api/exec/cmds?cmdfile=playback.commands", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	var result ExecutedCommandsResponse
+	err = json.Unmarshal(respRec.Body.Bytes(), &result)
+	expect(t, err, nil)
+	expect(t, result.Data.NumberOfErrors, 0)
+	expect(t, responseCall, "/stubo/api/v2/scenarios/objects/first/stubs first_1")
+	expect(t, responseBody, "please get my stub")
+}
+
+func TestLegacyFallthrough(t *testing.T) {
+	testData := `translated`
+	server, c := testTools(200, testData)
+	defer server.Close()
+
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "legacy "+r.URL.Path+"?"+r.URL.RawQuery)
+	}))
+	defer legacy.Close()
+
+	m := setupConfig(*c, Configuration{LegacyStuboURI: legacy.URL})
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/modulelist?name=module_1", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+	// reading resposne body
+	body, err := ioutil.ReadAll(respRec.Body)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, string(body), "legacy /stubo/api/get/modulelist?name=module_1")
+}
+
+func TestLegacyFallthroughNotConfigured(t *testing.T) {
+	testData := `translated`
+	server, c := testTools(200, testData)
+	m := setup(*c)
+
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/modulelist", nil)
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusNotFound)
+}
+
+func TestPutStubsHandlerStreamsBody(t *testing.T) {
+	var received []byte
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(201)
+		fmt.Fprint(w, "inserted")
+	})
+	m := setup(*c)
+
+	defer server.Close()
+
+	payload := strings.Repeat("<soap>payload</soap>", 10000)
+	req, err := http.NewRequest("POST", "/stubo/api/put/stub?session=scenario:session", strings.NewReader(payload))
+	// no error is expected
+	expect(t, err, nil)
+
+	//The response recorder used to record HTTP responses
+	respRec := httptest.NewRecorder()
+
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusCreated)
+	expect(t, respRec.Body.String(), "inserted")
+	expect(t, string(received), payload)
+}
+
+func TestStreamedStuboErrors(t *testing.T) {
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("session") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"version": "0.7", "error": {"code": 404, "message": "session not found"}}`)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "Internal Server Error")
+	})
+	m := setup(*c)
+
+	defer server.Close()
+
+	// Stubo error envelope
+	req, err := http.NewRequest("POST", "/stubo/api/get/response?session=scenario:missing", strings.NewReader("request"))
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusNotFound)
+	expect(t, respRec.Header().Get("Content-Type"), "application/json")
+	var result ErrorToClient
+	err = json.Unmarshal(respRec.Body.Bytes(), &result)
+	expect(t, err, nil)
+	expect(t, result.Version, "0.7")
+	expect(t, result.Error.Code, http.StatusNotFound)
+	expect(t, result.Error.Message, "session not found")
+
+	// Stubo error without envelope
+	req, err = http.NewRequest("POST", "/stubo/api/put/stub?session=scenario:session", strings.NewReader("stub"))
+	expect(t, err, nil)
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusInternalServerError)
+	expect(t, respRec.Header().Get("Content-Type"), "application/json")
+	result = ErrorToClient{}
+	err = json.Unmarshal(respRec.Body.Bytes(), &result)
+	expect(t, err, nil)
+	expect(t, result.Error.Code, http.StatusInternalServerError)
+	expect(t, result.Error.Message, "Stubo responded with status code 500.")
+}
+
+func TestGetStubResponseHandlerMaxBodySize(t *testing.T) {
+	testData := `Some response`
+	server, c := testTools(200, testData)
+	m := setupConfig(*c, Configuration{MaxBodyBytes: 10})
+
+	defer server.Close()
+
+	// body length is known upfront
+	req, err := http.NewRequest("POST", "/stubo/api/get/response?session=sce:x",
+		strings.NewReader("anything here, proxy doesn't unmarshall it anyway"))
+	// no error is expected
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusRequestEntityTooLarge)
+
+	// body length is unknown, limit is enforced while streaming
+	req, err = http.NewRequest("POST", "/stubo/api/get/response?session=sce:x",
+		ioutil.NopCloser(strings.NewReader("anything here, proxy doesn't unmarshall it anyway")))
+	expect(t, err, nil)
+	req.ContentLength = -1
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusRequestEntityTooLarge)
+}
+
+func TestCircuitBreakerShortCircuit(t *testing.T) {
+	calls := 0
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(502)
+	})
+	defer server.Close()
+	c.Breaker = stubo.NewCircuitBreaker(stubo.CircuitBreakerConfig{FailureThreshold: 1, CoolDownMs: 60000})
+	m := setup(*c)
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/scenarios", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+	expect(t, calls, 1)
+
+	// circuit is open, Stubo is not called
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+	expect(t, calls, 1)
+	expect(t, respRec.Code, http.StatusServiceUnavailable)
+	expect(t, respRec.Header().Get("Content-Type"), "application/json")
+	expect(t, strings.Contains(respRec.Body.String(), "circuit breaker is open"), true)
+
+	// state is available through admin endpoint
+	req, err = http.NewRequest("GET", "/lgc/admin/circuit_breaker", nil)
+	expect(t, err, nil)
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, strings.Contains(respRec.Body.String(), `"state":"open"`), true)
+}
@@ -0,0 +1,33 @@
+// Package util holds helpers that are shared by LGC and its Stubo client
+package util
+
+import (
+	"runtime"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Trace returns name of the current function
+func Trace() string {
+	pc := make([]uintptr, 10) // at least 1 entry needed
+	runtime.Callers(2, pc)
+	f := runtime.FuncForPC(pc[0])
+	return f.Name()
+}
+
+// LoggerOrDefault returns given logger or standard logrus logger if it is not set
+func LoggerOrDefault(logger *log.Logger) *log.Logger {
+	if logger == nil {
+		return log.StandardLogger()
+	}
+	return logger
+}
+
+// Duration converts milliseconds to duration, falling back to default value
+func Duration(ms int, def time.Duration) time.Duration {
+	if ms <= 0 {
+		return def
+	}
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,22 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	if d := Duration(0, time.Second); d != time.Second {
+		t.Errorf("Expected %v - Got %v", time.Second, d)
+	}
+	if d := Duration(1500, time.Second); d != 1500*time.Millisecond {
+		t.Errorf("Expected %v - Got %v", 1500*time.Millisecond, d)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	if name := Trace(); !strings.HasSuffix(name, ".TestTrace") {
+		t.Errorf("Expected caller name - Got %v", name)
+	}
+}
@@ -0,0 +1,105 @@
+package lgc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a parsed JSONPath expression. Supported subset: root "$",
+// fields ".name" and "['name']", array indexes "[0]" and wildcards "[*]"
+// and ".*", which is enough to pick values from Stubo responses
+type jsonPath []string
+
+// wildcard selects all elements of array or all values of object
+const wildcard = "*"
+
+// parseJSONPath parses expression such as "$.data[*].name"
+func parseJSONPath(expr string) (jsonPath, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("JSONPath '%s' must start with '$'", expr)
+	}
+	var path jsonPath
+	rest := expr[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("JSONPath '%s' has empty field name", expr)
+			}
+			path = append(path, rest[:end])
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath '%s' has unclosed '['", expr)
+			}
+			segment := strings.Trim(rest[1:end], `'"`)
+			if segment == "" {
+				return nil, fmt.Errorf("JSONPath '%s' has empty brackets", expr)
+			}
+			path = append(path, segment)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("JSONPath '%s' is invalid at '%s'", expr, rest)
+		}
+	}
+	return path, nil
+}
+
+// find returns all values that match path in decoded JSON document
+func (path jsonPath) find(doc interface{}) []interface{} {
+	values := []interface{}{doc}
+	for _, segment := range path {
+		var next []interface{}
+		for _, value := range values {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				if segment == wildcard {
+					for _, field := range v {
+						next = append(next, field)
+					}
+				} else if field, ok := v[segment]; ok {
+					next = append(next, field)
+				}
+			case []interface{}:
+				if segment == wildcard {
+					next = append(next, v...)
+				} else if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(v) {
+					next = append(next, v[i])
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// findStrings decodes JSON document and returns matching values as strings,
+// values that are not strings are encoded as JSON
+func (path jsonPath) findStrings(body []byte) ([]string, error) {
+	var doc interface{}
+	err := json.Unmarshal(body, &doc)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, value := range path.find(doc) {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, string(encoded))
+	}
+	return result, nil
+}
@@ -0,0 +1,38 @@
+package lgc
+
+import (
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	body := []byte(`{"version": "0.6.6", "data": [{"name": "slow", "delay": 50}, {"name": "fast", "delay": 0}]}`)
+
+	cases := []struct {
+		expr     string
+		expected []string
+	}{
+		{"$.version", []string{"0.6.6"}},
+		{"$.data[*].name", []string{"slow", "fast"}},
+		{"$['data'][1]['name']", []string{"fast"}},
+		{"$.data[0].delay", []string{"50"}},
+		{"$.data[5].name", nil},
+		{"$.missing", nil},
+	}
+	for _, c := range cases {
+		path, err := parseJSONPath(c.expr)
+		expect(t, err, nil)
+		values, err := path.findStrings(body)
+		expect(t, err, nil)
+		expect(t, len(values), len(c.expected))
+		for i := range c.expected {
+			expect(t, values[i], c.expected[i])
+		}
+	}
+}
+
+func TestParseJSONPathInvalid(t *testing.T) {
+	for _, expr := range []string{"", "data", "$.", "$[", "$[]", "$data"} {
+		_, err := parseJSONPath(expr)
+		refute(t, err, nil)
+	}
+}
@@ -0,0 +1,57 @@
+package lgc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+)
+
+// legacyTransformerKey - context key of transformer for legacy Stubo call
+type legacyTransformerKey struct{}
+
+// newLegacyProxy returns handler that forwards requests to legacy Stubo
+// instance. It is used for API calls that are not translated by LGC (such as
+// put/module, get/modulelist or bookmarks), calls are changed only by
+// transformers
+func newLegacyProxy(uri string, logger *log.Logger, transformers *TransformerRegistry) (http.Handler, error) {
+	target, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		// legacy Stubo should see its own hostname
+		req.Host = target.Host
+		if t, ok := req.Context().Value(legacyTransformerKey{}).(Transformer); ok {
+			t.BeforeUpstream(req)
+		}
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if t, ok := resp.Request.Context().Value(legacyTransformerKey{}).(Transformer); ok {
+			t.AfterUpstream(resp)
+		}
+		return nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// setting logger
+		method := util.Trace()
+		logger.WithFields(log.Fields{
+			"url_query": r.URL.Query(),
+			"url_path":  r.URL.Path,
+			"legacyURI": uri,
+			"func":      method,
+		}).Info("Call is not translated, forwarding it to legacy Stubo")
+
+		if t := transformers.Get(r.URL.Path); t != nil {
+			r = r.WithContext(context.WithValue(r.Context(), legacyTransformerKey{}, t))
+		}
+		proxy.ServeHTTP(w, r)
+	}), nil
+}
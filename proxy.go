@@ -0,0 +1,92 @@
+package lgc
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+	"github.com/rusenask/lgc/stubo"
+)
+
+// Proxy translates legacy Stubo API calls to Stubo API v2. Every proxy has
+// its own configuration, Stubo client, sessions and logger, so several
+// proxies can run in one process (e.g. when LGC is embedded in test harness)
+type Proxy struct {
+	config       Configuration
+	client       *stubo.Client
+	transformers *TransformerRegistry
+	handler      http.Handler
+	stop         chan struct{}
+}
+
+// NewProxy returns proxy for given configuration. When multiple Stubo nodes
+// are configured their health checks are started, call Close to stop them
+func NewProxy(cfg Configuration) (*Proxy, error) {
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = newHTTPClient(cfg.Timeouts)
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.StandardLogger()
+	}
+
+	client := &stubo.Client{
+		HTTPClient:  httpClient,
+		StuboURI:    cfg.StuboURI(),
+		Retry:       cfg.Retry,
+		Breaker:     stubo.NewCircuitBreaker(cfg.CircuitBreaker),
+		Timeout:     util.Duration(cfg.Timeouts.TotalMs, defaultTotalTimeout),
+		BulkTimeout: util.Duration(cfg.Timeouts.BulkMs, defaultBulkTimeout),
+		Logger:      logger,
+	}
+	client.Breaker.SetLogger(logger)
+
+	p := &Proxy{
+		config:       cfg,
+		client:       client,
+		transformers: NewTransformerRegistry(cfg.Transformers),
+		stop:         make(chan struct{}),
+	}
+	if len(cfg.Upstreams.URIs) > 0 {
+		client.Upstreams = stubo.NewUpstreamPool(cfg.Upstreams)
+		client.Upstreams.SetLogger(logger)
+		client.Upstreams.StartHealthChecks(httpClient, cfg.Upstreams, p.stop)
+	}
+
+	tenants := newTenantUpstreams(cfg.Tenants, cfg.CircuitBreaker, logger)
+	mux, err := getRouter(HandlerHTTPClient{
+		http:         *client,
+		config:       cfg,
+		sessions:     NewSessionRegistry(util.Duration(cfg.SessionTTLMs, defaultSessionTTL)),
+		transformers: p.transformers,
+		tenants:      tenants,
+	})
+	if err != nil {
+		close(p.stop)
+		return nil, err
+	}
+	p.handler = newTenantRouter(cfg.Tenants, tenants, logger, mux)
+	return p, nil
+}
+
+// Handler returns HTTP handler that serves legacy Stubo API
+func (p *Proxy) Handler() http.Handler {
+	return p.handler
+}
+
+// RegisterTransformer adds transformers for legacy route path, e.g.
+// "/stubo/api/put/stub", use "*" for all routes. Transformers can be
+// registered while proxy is serving
+func (p *Proxy) RegisterTransformer(route string, transformers ...Transformer) {
+	p.transformers.Register(route, transformers...)
+}
+
+// Close stops Stubo nodes health checks
+func (p *Proxy) Close() {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+}
@@ -0,0 +1,55 @@
+package lgc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// proxyConfig returns configuration that points to given test server
+func proxyConfig(t *testing.T, server *httptest.Server) Configuration {
+	u, err := url.Parse(server.URL)
+	expect(t, err, nil)
+	return Configuration{
+		StuboProtocol: u.Scheme,
+		StuboHost:     u.Hostname(),
+		StuboPort:     u.Port(),
+	}
+}
+
+func TestNewProxy(t *testing.T) {
+	t.Parallel()
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "first")
+	}))
+	defer first.Close()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "second")
+	}))
+	defer second.Close()
+
+	// two proxies in one process, each calls its own Stubo
+	for _, server := range []*httptest.Server{first, second} {
+		proxy, err := NewProxy(proxyConfig(t, server))
+		expect(t, err, nil)
+		defer proxy.Close()
+
+		req, err := http.NewRequest("GET", "/stubo/api/get/stublist?scenario=scenario1", nil)
+		expect(t, err, nil)
+		respRec := httptest.NewRecorder()
+		proxy.Handler().ServeHTTP(respRec, req)
+		body, err := ioutil.ReadAll(respRec.Body)
+
+		expect(t, respRec.Code, http.StatusOK)
+		expect(t, string(body), map[*httptest.Server]string{first: "first", second: "second"}[server])
+	}
+}
+
+func TestNewProxyBadLegacyURI(t *testing.T) {
+	t.Parallel()
+	_, err := NewProxy(Configuration{LegacyStuboURI: "://bad"})
+	refute(t, err, nil)
+}
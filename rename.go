@@ -0,0 +1,164 @@
+package lgc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+	"github.com/rusenask/lgc/stubo"
+)
+
+// renameResult holds details about scenario rename
+type renameResult struct {
+	version string
+	stubs   int
+}
+
+// rollbackTimeout - time given to rename rollback, rollback is not stopped
+// when client disconnects
+const rollbackTimeout = 60 * time.Second
+
+// renameScenario emulates scenario rename since it is not available in API v2.
+// New scenario is created, stubs are copied into it (grouped by their original
+// sessions) and then stubs are deleted from the old scenario. If any of the
+// steps fails - new scenario is removed, unless old scenario might have lost
+// its stubs, then both scenarios are kept. Returns status code that should be
+// passed to the client.
+func renameScenario(ctx context.Context, c *stubo.Client, scenario, newName string) (renameResult, int, error) {
+	var result renameResult
+
+	// setting logger
+	method := util.Trace()
+	logger := util.LoggerOrDefault(c.Logger).WithFields(log.Fields{
+		"scenario": scenario,
+		"new_name": newName,
+		"func":     method,
+	})
+
+	stubs, err := c.ListScenarioStubs(ctx, scenario)
+	if err != nil {
+		return result, stubo.StatusCode(err), err
+	}
+	result.version = stubs.Version
+
+	_, err = c.CreateScenario(ctx, newName)
+	if stubo.StatusCode(err) == http.StatusUnprocessableEntity {
+		// scenario already exists, it must not be touched
+		return result, http.StatusConflict, fmt.Errorf("scenario '%s' already exists", newName)
+	}
+	if err != nil {
+		return result, stubo.StatusCode(err), err
+	}
+
+	err = copyStubs(ctx, c, *stubs, newName)
+	if err != nil {
+		logger.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Warn("Failed to copy stubs, rolling back")
+		return result, stubo.StatusCode(err), rollback(c, newName, err)
+	}
+	result.stubs = len(stubs.Data)
+
+	_, err = c.DeleteScenarioStubs(ctx, stubo.DeleteStubsRequest{Scenario: scenario, Force: "true"})
+	if err != nil {
+		// stubs may have been deleted even though the call failed (e.g. on
+		// timeout), new scenario is removed only if old one is intact
+		rollbackCtx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+		defer cancel()
+		left, listErr := c.ListScenarioStubs(rollbackCtx, scenario)
+		if listErr != nil || len(left.Data) != len(stubs.Data) {
+			logger.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Error("Failed to delete stubs of old scenario, keeping both scenarios")
+			return result, stubo.StatusCode(err), fmt.Errorf("%s, stubs were copied to '%s' but old scenario might have lost them, both scenarios are kept", err.Error(), newName)
+		}
+		logger.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Warn("Failed to delete stubs of old scenario, rolling back")
+		return result, stubo.StatusCode(err), rollback(c, newName, err)
+	}
+
+	logger.WithFields(log.Fields{
+		"stubs": result.stubs,
+	}).Info("Scenario renamed")
+	return result, http.StatusOK, nil
+}
+
+// copyStubs puts given stubs into scenario. Stubs can only be added to a
+// session in record mode, so record session is started for every original
+// session and ended after all of its stubs are added.
+func copyStubs(ctx context.Context, c *stubo.Client, stubs stubo.ScenarioStubsResponse, scenario string) error {
+	var sessions []string
+	bySession := make(map[string][]stubo.StubDetail)
+	for _, stub := range stubs.Data {
+		var meta stubMeta
+		json.Unmarshal(stub.Stub, &meta)
+		session := meta.Session
+		if session == "" {
+			session = scenario + "_rename"
+		}
+		if _, ok := bySession[session]; !ok {
+			sessions = append(sessions, session)
+		}
+		bySession[session] = append(bySession[session], stub)
+	}
+
+	for _, session := range sessions {
+		req := stubo.SessionRequest{Scenario: scenario, Session: session, Mode: "record"}
+		if _, err := c.BeginSession(ctx, req); err != nil {
+			return err
+		}
+		for _, stub := range bySession[session] {
+			var meta stubMeta
+			json.Unmarshal(stub.Stub, &meta)
+			headers := make(map[string]string)
+			if meta.DelayPolicy != "" {
+				headers["delay_policy"] = meta.DelayPolicy
+			}
+			if meta.Module != "" {
+				headers["ext_module"] = meta.Module
+			}
+			if meta.Stateful != nil {
+				headers["stateful"] = fmt.Sprint(meta.Stateful)
+			}
+			_, err := c.PutStub(ctx, stubo.StubRequest{
+				Scenario: scenario,
+				Session:  session,
+				Headers:  headers,
+				Body:     stub.Stub,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := c.EndSession(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback removes new scenario after failed rename and returns rename error.
+// Rollback gets its own context, so it is finished when client disconnects
+func rollback(c *stubo.Client, newName string, err error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+	if rollbackErr := removeScenario(ctx, c, newName); rollbackErr != nil {
+		return fmt.Errorf("%s, rollback failed: %s", err.Error(), rollbackErr.Error())
+	}
+	return err
+}
+
+// removeScenario deletes all scenario stubs and then scenario itself
+func removeScenario(ctx context.Context, c *stubo.Client, scenario string) error {
+	_, err := c.DeleteScenarioStubs(ctx, stubo.DeleteStubsRequest{Scenario: scenario, Force: "true"})
+	if err != nil && stubo.StatusCode(err) != http.StatusNotFound {
+		return err
+	}
+	_, err = c.DeleteScenario(ctx, scenario)
+	return err
+}
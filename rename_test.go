@@ -0,0 +1,127 @@
+package lgc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRenameScenario(t *testing.T) {
+	testData := `{"version": "0.6.6",
+		"data": [{"stub": {"request": {}, "response": {}, "session": "session_1", "delay_policy": "slow"}},
+		         {"stub": {"request": {}, "response": {}}}]}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+
+	result, code, err := renameScenario(context.Background(), c, "first", "second")
+	expect(t, err, nil)
+	expect(t, code, http.StatusOK)
+	expect(t, result.stubs, 2)
+	expect(t, result.version, "0.6.6")
+}
+
+func TestRenameScenarioExists(t *testing.T) {
+	var calls []string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Method == "PUT" && r.URL.Path == "/stubo/api/v2/scenarios" {
+			w.WriteHeader(422)
+		}
+		fmt.Fprintln(w, `{"version": "0.6.6", "data": []}`)
+	})
+	defer server.Close()
+
+	_, code, err := renameScenario(context.Background(), c, "first", "second")
+	refute(t, err, nil)
+	expect(t, code, http.StatusConflict)
+	// nothing should be deleted
+	for _, call := range calls {
+		expect(t, strings.HasPrefix(call, "DELETE"), false)
+	}
+}
+
+func TestRenameScenarioRollback(t *testing.T) {
+	var calls []string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/stubs") {
+			w.WriteHeader(500)
+		}
+		fmt.Fprintln(w, `{"version": "0.6.6", "data": [{"stub": {"request": {}, "response": {}}}]}`)
+	})
+	defer server.Close()
+
+	_, code, err := renameScenario(context.Background(), c, "first", "second")
+	refute(t, err, nil)
+	expect(t, code, http.StatusInternalServerError)
+
+	// stubs of old scenario must stay, new scenario must be removed
+	expect(t, calls[len(calls)-2], "DELETE /stubo/api/v2/scenarios/objects/second/stubs")
+	expect(t, calls[len(calls)-1], "DELETE /stubo/api/v2/scenarios/objects/second")
+	for _, call := range calls {
+		refute(t, call, "DELETE /stubo/api/v2/scenarios/objects/first/stubs")
+	}
+}
+
+func TestRenameScenarioNotFound(t *testing.T) {
+	server, c := testTools(404, `{"version": "0.6.6", "error": {"code": 404, "message": "Scenario not found"}}`)
+	defer server.Close()
+
+	_, code, err := renameScenario(context.Background(), c, "first", "second")
+	refute(t, err, nil)
+	expect(t, code, http.StatusNotFound)
+}
+
+func TestRenameScenarioDeleteFailedKeepsBoth(t *testing.T) {
+	var calls []string
+	deleted := false
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Method == "DELETE" {
+			// stubs were deleted, but Stubo reported failure
+			deleted = true
+			w.WriteHeader(500)
+		}
+		if r.Method == "GET" && deleted {
+			fmt.Fprintln(w, `{"version": "0.6.6", "data": []}`)
+			return
+		}
+		fmt.Fprintln(w, `{"version": "0.6.6", "data": [{"stub": {"request": {}, "response": {}}}]}`)
+	})
+	defer server.Close()
+
+	_, code, err := renameScenario(context.Background(), c, "first", "second")
+	refute(t, err, nil)
+	expect(t, code, http.StatusInternalServerError)
+	// new scenario holds the only copy of stubs
+	for _, call := range calls {
+		expect(t, strings.HasPrefix(call, "DELETE /stubo/api/v2/scenarios/objects/second"), false)
+	}
+}
+
+func TestRenameScenarioDeleteFailedRollback(t *testing.T) {
+	var calls []string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/stubo/api/v2/scenarios/objects/first") {
+			w.WriteHeader(500)
+		}
+		fmt.Fprintln(w, `{"version": "0.6.6", "data": [{"stub": {"request": {}, "response": {}}}]}`)
+	})
+	defer server.Close()
+
+	// rollback is finished after client is gone
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Transformer = TransformerFuncs{After: func(resp *http.Response) {
+		if resp.Request.Method == "DELETE" {
+			cancel()
+		}
+	}}
+	_, code, err := renameScenario(ctx, c, "first", "second")
+	refute(t, err, nil)
+	expect(t, code, http.StatusInternalServerError)
+	expect(t, calls[len(calls)-2], "DELETE /stubo/api/v2/scenarios/objects/second/stubs")
+	expect(t, calls[len(calls)-1], "DELETE /stubo/api/v2/scenarios/objects/second")
+}
@@ -0,0 +1,547 @@
+package lgc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/go-zoo/bone"
+	"github.com/rusenask/lgc/internal/util"
+	"github.com/rusenask/lgc/stubo"
+)
+
+// RouteConfig describes translation of legacy API call to one API v2 call or
+// to a workflow of several calls (Steps).
+// Placeholders such as {scenario} in Target, Headers, Body, Affinity and
+// Response are replaced with URL query arguments of the legacy call and with
+// variables extracted by earlier steps, legacy call gets 400 response if
+// argument is missing. Optional placeholders such as {host?} are replaced
+// with empty string, headers with empty value are not sent
+type RouteConfig struct {
+	// Path - legacy path, e.g. "/stubo/api/get/stublist"
+	Path string
+	// Methods - legacy methods, defaults to GET
+	Methods []string
+	// Split - arguments that are split by ":" into several arguments, e.g.
+	// {"session": ["scenario", "session"]} for session=scenario:session, values
+	// with missing or extra parts get 400 response
+	Split map[string][]string
+	// CallConfig - API v2 call, not used when route has steps
+	CallConfig
+	// PassBody - legacy request body is streamed to Stubo and Stubo response is
+	// streamed back, can't be used together with Body, BodyArgs and Steps
+	PassBody bool
+	// ContentType - content type of streamed Stubo response, defaults to
+	// "application/json"
+	ContentType string
+	// Steps - API v2 calls that are made one after another, legacy call gets
+	// response of the last call
+	Steps []StepConfig
+	// Response - JSON response template, used instead of Stubo response
+	Response map[string]interface{}
+}
+
+// CallConfig describes API v2 call
+type CallConfig struct {
+	// TargetMethod - API v2 method, defaults to GET
+	TargetMethod string
+	// Target - API v2 path template, e.g. "/stubo/api/v2/scenarios/objects/{scenario}/stubs",
+	// arguments are escaped when they are put into path
+	Target string
+	// Headers - header templates, e.g. {"session": "{session}"}
+	Headers map[string]string
+	// HeaderArgs - arguments that are sent to Stubo as headers if present
+	HeaderArgs []string
+	// Body - JSON body template, e.g. {"begin": null, "session": "{session}"}
+	Body map[string]interface{}
+	// BodyArgs - arguments that are added to JSON body if present
+	BodyArgs []string
+	// PassArgs - arguments that are not used by route are forwarded to Stubo
+	// URL query
+	PassArgs bool
+	// Affinity - "scenario:session" template, calls with the same key go to the
+	// same Stubo node
+	Affinity string
+	// Bulk - call gets bulk timeout
+	Bulk bool
+}
+
+// StepConfig describes API v2 call of workflow
+type StepConfig struct {
+	CallConfig
+	// Accept - Stubo error status codes that don't fail the workflow, e.g. 422
+	// when scenario that is being created already exists
+	Accept []int
+	// Extract - variables that are extracted from step response with JSONPath,
+	// e.g. {"version": "$.version"}
+	Extract map[string]string
+	// ForEach - JSONPath of values in previous step response, step is called
+	// for every value, e.g. "$.data[*].name"
+	ForEach string
+	// As - variable that holds current ForEach value, defaults to "item".
+	// Number of values is available as {<As>_count}
+	As string
+}
+
+// routeMethods - methods that routes can use
+var routeMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "DELETE": true}
+
+// routes returns routes from configuration followed by routes from routes file
+func (c Configuration) routes() ([]RouteConfig, error) {
+	routes := append([]RouteConfig{}, c.Routes...)
+	if c.RoutesFile != "" {
+		data, err := ioutil.ReadFile(c.RoutesFile)
+		if err != nil {
+			return nil, fmt.Errorf("routes: failed to read routes file: %s", err)
+		}
+		var fromFile []RouteConfig
+		err = json.Unmarshal(data, &fromFile)
+		if err != nil {
+			return nil, fmt.Errorf("routes: failed to parse routes file '%s': %s", c.RoutesFile, err)
+		}
+		routes = append(routes, fromFile...)
+	}
+	for i, route := range routes {
+		err := route.validate()
+		if err != nil {
+			return nil, fmt.Errorf("routes: route %d (%s): %s", i, route.Path, err)
+		}
+	}
+	return routes, nil
+}
+
+// validate checks route configuration
+func (route RouteConfig) validate() error {
+	if !strings.HasPrefix(route.Path, "/") {
+		return fmt.Errorf("path must start with '/'")
+	}
+	for _, method := range route.Methods {
+		if !routeMethods[method] {
+			return fmt.Errorf("unknown method '%s'", method)
+		}
+	}
+	if len(route.Steps) == 0 {
+		if route.PassBody && (route.Body != nil || len(route.BodyArgs) > 0) {
+			return fmt.Errorf("passBody can't be used together with body and bodyArgs")
+		}
+		return route.CallConfig.validate()
+	}
+
+	if route.Target != "" || route.PassBody {
+		return fmt.Errorf("route with steps can't have target or passBody")
+	}
+	for i, step := range route.Steps {
+		err := step.validate()
+		if err != nil {
+			return fmt.Errorf("step %d: %s", i, err)
+		}
+		if i == 0 && step.ForEach != "" {
+			return fmt.Errorf("step 0: forEach needs previous step response")
+		}
+	}
+	return nil
+}
+
+// validate checks API v2 call configuration
+func (call CallConfig) validate() error {
+	if !strings.HasPrefix(call.Target, "/") {
+		return fmt.Errorf("target must start with '/'")
+	}
+	if call.TargetMethod != "" && !routeMethods[call.TargetMethod] {
+		return fmt.Errorf("unknown target method '%s'", call.TargetMethod)
+	}
+	templates := []string{call.Target, call.Affinity}
+	for _, header := range call.Headers {
+		templates = append(templates, header)
+	}
+	for _, template := range templates {
+		if strings.Count(template, "{") != strings.Count(template, "}") {
+			return fmt.Errorf("unbalanced placeholder in '%s'", template)
+		}
+	}
+	return nil
+}
+
+// validate checks workflow step configuration
+func (step StepConfig) validate() error {
+	err := step.CallConfig.validate()
+	if err != nil {
+		return err
+	}
+	for _, code := range step.Accept {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid accepted status code %d", code)
+		}
+	}
+	for name, expr := range step.Extract {
+		if _, err := parseJSONPath(expr); err != nil {
+			return fmt.Errorf("extract '%s': %s", name, err)
+		}
+	}
+	if step.ForEach != "" {
+		if _, err := parseJSONPath(step.ForEach); err != nil {
+			return fmt.Errorf("forEach: %s", err)
+		}
+	}
+	return nil
+}
+
+// addRoutes registers configured routes on the router
+func (h HandlerHTTPClient) addRoutes(mux *bone.Mux, routes []RouteConfig) {
+	for _, route := range routes {
+		handler := h.handle(h.routeHandler(route))
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = []string{"GET"}
+		}
+		for _, method := range methods {
+			switch method {
+			case "GET":
+				mux.Get(route.Path, handler)
+			case "POST":
+				mux.Post(route.Path, handler)
+			case "PUT":
+				mux.Put(route.Path, handler)
+			case "DELETE":
+				mux.Delete(route.Path, handler)
+			}
+		}
+	}
+}
+
+// routeHandler translates legacy call according to route configuration
+func (h HandlerHTTPClient) routeHandler(route RouteConfig) errorHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		// setting context logger
+		method := util.Trace()
+		handlersContextLogger := h.logger().WithFields(log.Fields{
+			"url_query": r.URL.Query(),
+			"url_path":  r.URL.Path,
+			"func":      method,
+		})
+
+		vars, used, err := route.vars(r)
+		if err != nil {
+			return err
+		}
+		client := h.client(r)
+
+		var response *stubo.Response
+		if len(route.Steps) > 0 {
+			handlersContextLogger.WithFields(log.Fields{
+				"steps": len(route.Steps),
+			}).Info("Running configured workflow")
+			response, err = route.runSteps(r, client, vars, used)
+			if err != nil {
+				return err
+			}
+		} else {
+			req, err := route.request(route.Path, r.URL.RawQuery, vars, used)
+			if err != nil {
+				return err
+			}
+			handlersContextLogger.WithFields(log.Fields{
+				"urlPath": req.Path,
+			}).Info("Translating legacy call with configured route")
+
+			if route.PassBody {
+				if err := h.limitBody(w, r); err != nil {
+					return err
+				}
+				defer r.Body.Close()
+				resp, err := client.DoStream(r.Context(), req, r.Body)
+				if err != nil {
+					return err
+				}
+				contentType := route.ContentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				return h.streamResponse(w, r, resp, contentType)
+			}
+			response, err = client.Do(r.Context(), req)
+			if err != nil {
+				return err
+			}
+		}
+
+		if route.Response != nil {
+			body, err := expandValue(map[string]interface{}(route.Response), vars, used)
+			if err != nil {
+				return err
+			}
+			return h.writeJSON(w, http.StatusOK, body)
+		}
+		if response == nil {
+			// workflow didn't make any calls
+			return h.writeJSON(w, http.StatusOK, &ResponseToClient{Data: map[string]string{}})
+		}
+		return h.writeResponse(w, response, nil)
+	}
+}
+
+// vars returns first value of every URL query argument and arguments that
+// were split. Split arguments are marked as used
+func (route RouteConfig) vars(r *http.Request) (map[string]string, map[string]bool, error) {
+	vars := make(map[string]string)
+	for _, arg := range parseQueryArgs(r.URL.RawQuery) {
+		if _, ok := vars[arg.key]; !ok {
+			vars[arg.key] = arg.value
+		}
+	}
+	// arguments that are used by route are not passed through
+	used := make(map[string]bool)
+	for arg, names := range route.Split {
+		value, ok := vars[arg]
+		if !ok {
+			continue
+		}
+		used[arg] = true
+		parts, ok := splitArg(value, len(names))
+		if !ok {
+			return nil, nil, badRequest(fmt.Sprintf("Bad request, '%s' must be in '%s' format.", arg, strings.Join(names, ":")))
+		}
+		for i, name := range names {
+			vars[name] = parts[i]
+		}
+	}
+	return vars, used, nil
+}
+
+// runSteps makes workflow calls and returns response of the last call.
+// Variables extracted from responses are added to vars
+func (route RouteConfig) runSteps(r *http.Request, client *stubo.Client, vars map[string]string, used map[string]bool) (*stubo.Response, error) {
+	var last *stubo.Response
+	for i, step := range route.Steps {
+		op := fmt.Sprintf("%s step %d", route.Path, i)
+		items := []string{""}
+		as := step.As
+		if as == "" {
+			as = "item"
+		}
+		if step.ForEach != "" {
+			if last == nil {
+				// previous steps were called for empty lists
+				items = nil
+			} else {
+				path, _ := parseJSONPath(step.ForEach)
+				values, err := path.findStrings(last.Body)
+				if err != nil {
+					return nil, &Error{Code: http.StatusBadGateway, Message: op + ": failed to read Stubo response: " + err.Error(), Err: err}
+				}
+				items = values
+			}
+			vars[as+"_count"] = strconv.Itoa(len(items))
+		}
+
+		var stepResponse *stubo.Response
+		for _, item := range items {
+			if step.ForEach != "" {
+				vars[as] = item
+			}
+			req, err := step.request(op, r.URL.RawQuery, vars, copyUsed(used))
+			if err != nil {
+				return nil, err
+			}
+			response, err := client.Do(r.Context(), req)
+			if err != nil {
+				response, err = step.accept(err)
+				if err != nil {
+					return nil, err
+				}
+			}
+			stepResponse = response
+			err = step.extract(op, response, vars)
+			if err != nil {
+				return nil, err
+			}
+		}
+		last = stepResponse
+	}
+	return last, nil
+}
+
+// accept returns Stubo error response as step response when its status code
+// is accepted
+func (step StepConfig) accept(err error) (*stubo.Response, error) {
+	var stuboErr *stubo.Error
+	if !errors.As(err, &stuboErr) || stuboErr.Body == nil {
+		return nil, err
+	}
+	for _, code := range step.Accept {
+		if code == stuboErr.StatusCode {
+			return &stubo.Response{StatusCode: stuboErr.StatusCode, Body: stuboErr.Body}, nil
+		}
+	}
+	return nil, err
+}
+
+// extract adds variables extracted from step response to vars
+func (step StepConfig) extract(op string, response *stubo.Response, vars map[string]string) error {
+	for name, expr := range step.Extract {
+		path, _ := parseJSONPath(expr)
+		values, err := path.findStrings(response.Body)
+		if err != nil {
+			return &Error{Code: http.StatusBadGateway, Message: op + ": failed to read Stubo response: " + err.Error(), Err: err}
+		}
+		if len(values) == 0 {
+			return &Error{Code: http.StatusBadGateway, Message: fmt.Sprintf("%s: Stubo response has no value at '%s'", op, expr)}
+		}
+		vars[name] = values[0]
+	}
+	return nil
+}
+
+// copyUsed returns copy of used arguments, so every call passes through
+// arguments that it doesn't use itself
+func copyUsed(used map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(used))
+	for k, v := range used {
+		c[k] = v
+	}
+	return c
+}
+
+// request builds API v2 call for legacy request
+func (call CallConfig) request(op, rawQuery string, vars map[string]string, used map[string]bool) (stubo.Request, error) {
+	var req stubo.Request
+	req.Op = op
+	req.Method = call.TargetMethod
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+	req.Bulk = call.Bulk
+
+	var err error
+	req.Path, err = expand(call.Target, vars, url.PathEscape, used)
+	if err != nil {
+		return req, err
+	}
+	req.Affinity, err = expand(call.Affinity, vars, nil, used)
+	if err != nil {
+		return req, err
+	}
+
+	templated := make(map[string]string)
+	for name, template := range call.Headers {
+		value, err := expand(template, vars, nil, used)
+		if err != nil {
+			return req, err
+		}
+		if value != "" {
+			templated[name] = value
+		}
+	}
+
+	if call.Body != nil || len(call.BodyArgs) > 0 {
+		body := make(map[string]interface{})
+		for field, value := range call.Body {
+			body[field], err = expandValue(value, vars, used)
+			if err != nil {
+				return req, err
+			}
+		}
+		for _, arg := range call.BodyArgs {
+			if value, ok := vars[arg]; ok {
+				used[arg] = true
+				body[arg] = value
+			}
+		}
+		req.Body, err = json.Marshal(body)
+		if err != nil {
+			return req, err
+		}
+	}
+
+	// arguments that were not used in templates or body become headers or
+	// are passed through
+	headerArgs := make(map[string]bool)
+	for _, arg := range call.HeaderArgs {
+		headerArgs[arg] = true
+	}
+	var skip []string
+	for arg := range used {
+		skip = append(skip, arg)
+	}
+	headers, args := getURLHeadersArgs(headerArgs, rawQuery, skip...)
+	for name, value := range templated {
+		headers[name] = value
+	}
+	req.Headers = headers
+	if call.PassArgs && args != "" {
+		req.Path += "?" + args
+	}
+	return req, nil
+}
+
+// expand replaces {name} placeholders in template with arguments, escaping
+// them when escape function is given. Used arguments are marked in used map
+func expand(template string, vars map[string]string, escape func(string) string, used map[string]bool) (string, error) {
+	var result strings.Builder
+	for {
+		start := strings.Index(template, "{")
+		if start < 0 {
+			result.WriteString(template)
+			return result.String(), nil
+		}
+		end := strings.Index(template[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("unbalanced placeholder in '%s'", template)
+		}
+		name := template[start+1 : start+end]
+		optional := strings.HasSuffix(name, "?")
+		name = strings.TrimSuffix(name, "?")
+		value, ok := vars[name]
+		if (!ok || value == "") && !optional {
+			return "", badRequest(fmt.Sprintf("Bad request, missing '%s' argument.", name))
+		}
+		used[name] = true
+		if escape != nil && value != "" {
+			// names put into path get the same validation as in built-in
+			// translations, so they can't traverse Stubo API
+			if err := stubo.ValidateName("'"+name+"' argument", value); err != nil {
+				return "", err
+			}
+			value = escape(value)
+		}
+		result.WriteString(template[:start])
+		result.WriteString(value)
+		template = template[start+end+1:]
+	}
+}
+
+// expandValue replaces placeholders in string values of JSON body template,
+// nested objects and arrays included
+func expandValue(value interface{}, vars map[string]string, used map[string]bool) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return expand(v, vars, nil, used)
+	case map[string]interface{}:
+		expanded := make(map[string]interface{})
+		for field, fieldValue := range v {
+			var err error
+			expanded[field], err = expandValue(fieldValue, vars, used)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return expanded, nil
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			expanded[i], err = expandValue(item, vars, used)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return expanded, nil
+	}
+	return value, nil
+}
@@ -0,0 +1,310 @@
+package lgc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stuboCall is a call received by test Stubo
+type stuboCall struct {
+	method, path, query string
+	header              http.Header
+	body                []byte
+}
+
+// routesSetup returns router with routes from routes.json.example and test
+// Stubo that records the last call
+func routesSetup() (http.Handler, *httptest.Server, *stuboCall) {
+	call := &stuboCall{}
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		call.method = r.Method
+		call.path = r.URL.EscapedPath()
+		call.query = r.URL.RawQuery
+		call.header = r.Header
+		call.body, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"version": "0.6.6", "data": {}}`))
+	})
+	return setupConfig(*c, Configuration{RoutesFile: "routes.json.example"}), server, call
+}
+
+func TestRoutesExample(t *testing.T) {
+	routes, err := Configuration{RoutesFile: "routes.json.example"}.routes()
+	expect(t, err, nil)
+	expect(t, len(routes), 8)
+}
+
+func TestRouteHandlerPutStub(t *testing.T) {
+	m, server, call := routesSetup()
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", "/stubo/api/put/stub?session=first:first_1&delay_policy=slow&x=2&x=1", strings.NewReader(`{"request": {}}`))
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, call.method, "PUT")
+	expect(t, call.path, "/stubo/api/v2/scenarios/objects/first/stubs")
+	expect(t, call.query, "x=2&x=1")
+	expect(t, call.header.Get("session"), "first_1")
+	expect(t, call.header.Get("delay_policy"), "slow")
+	expect(t, string(call.body), `{"request": {}}`)
+}
+
+func TestRouteHandlerBodyArgs(t *testing.T) {
+	m, server, call := routesSetup()
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/put/delay_policy?name=slow&delay_type=fixed&milliseconds=1000", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, call.method, "PUT")
+	expect(t, call.path, "/stubo/api/v2/delay-policy")
+	expect(t, call.query, "")
+	var body map[string]string
+	err = json.Unmarshal(call.body, &body)
+	expect(t, err, nil)
+	expect(t, body["name"], "slow")
+	expect(t, body["delay_type"], "fixed")
+	expect(t, body["milliseconds"], "1000")
+	_, ok := body["mean"]
+	expect(t, ok, false)
+}
+
+func TestRouteHandlerOptionalHeader(t *testing.T) {
+	m, server, call := routesSetup()
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/delete/stubs?scenario=a/b&host=otherhost&force=true", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, call.method, "DELETE")
+	expect(t, call.path, "/stubo/api/v2/scenarios/objects/a%2Fb/stubs")
+	expect(t, call.header.Get("target_host"), "otherhost")
+	expect(t, call.header.Get("force"), "true")
+
+	req, err = http.NewRequest("GET", "/stubo/api/delete/stubs?scenario=first", nil)
+	expect(t, err, nil)
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	_, ok := call.header["Target_host"]
+	expect(t, ok, false)
+}
+
+func TestRouteHandlerMissingArgument(t *testing.T) {
+	m, server, _ := routesSetup()
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/end/sessions", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusBadRequest)
+	var envelope ErrorToClient
+	err = json.Unmarshal(respRec.Body.Bytes(), &envelope)
+	expect(t, err, nil)
+	expect(t, envelope.Error.Message, "Bad request, missing 'scenario' argument.")
+}
+
+func TestRouteConfigValidate(t *testing.T) {
+	expect(t, RouteConfig{Path: "/a", CallConfig: CallConfig{Target: "/b/{c}"}}.validate(), nil)
+	refute(t, RouteConfig{Path: "a", CallConfig: CallConfig{Target: "/b"}}.validate(), nil)
+	refute(t, RouteConfig{Path: "/a", CallConfig: CallConfig{Target: ""}}.validate(), nil)
+	refute(t, RouteConfig{Path: "/a", CallConfig: CallConfig{Target: "/b"}, Methods: []string{"PATCH"}}.validate(), nil)
+	refute(t, RouteConfig{Path: "/a", CallConfig: CallConfig{Target: "/b/{c"}}.validate(), nil)
+	refute(t, RouteConfig{Path: "/a", CallConfig: CallConfig{Target: "/b", BodyArgs: []string{"c"}}, PassBody: true}.validate(), nil)
+}
+
+func TestRouteHandlerWorkflowAcceptsStatus(t *testing.T) {
+	var calls []stuboCall
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		calls = append(calls, stuboCall{method: r.Method, path: r.URL.EscapedPath(), body: body})
+		if r.Method == "PUT" {
+			w.WriteHeader(422)
+			w.Write([]byte(`{"version": "0.6.6", "error": {"code": 422, "message": "Scenario (localhost:first) already exists."}}`))
+			return
+		}
+		w.Write([]byte(`{"version": "0.6.6", "data": {"status": "playback", "session": "first_1"}}`))
+	})
+	defer server.Close()
+	m := setupConfig(*c, Configuration{RoutesFile: "routes.json.example"})
+
+	req, err := http.NewRequest("GET", "/stubo/api/begin/session?scenario=first&session=first_1&mode=playback", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, len(calls), 2)
+	expect(t, calls[0].path, "/stubo/api/v2/scenarios")
+	expect(t, string(calls[0].body), `{"scenario":"first"}`)
+	expect(t, calls[1].path, "/stubo/api/v2/scenarios/objects/first/action")
+	var body map[string]interface{}
+	err = json.Unmarshal(calls[1].body, &body)
+	expect(t, err, nil)
+	expect(t, body["session"], "first_1")
+	expect(t, body["mode"], "playback")
+	expect(t, strings.Contains(respRec.Body.String(), "first_1"), true)
+}
+
+func TestRouteHandlerWorkflowStepFails(t *testing.T) {
+	calls := 0
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(500)
+		w.Write([]byte(`{"version": "0.6.6", "error": {"code": 500, "message": "Database is down."}}`))
+	})
+	defer server.Close()
+	m := setupConfig(*c, Configuration{RoutesFile: "routes.json.example"})
+
+	req, err := http.NewRequest("GET", "/stubo/api/begin/session?scenario=first&session=first_1&mode=playback", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusInternalServerError)
+	expect(t, calls, 1)
+	var envelope ErrorToClient
+	err = json.Unmarshal(respRec.Body.Bytes(), &envelope)
+	expect(t, err, nil)
+	expect(t, envelope.Error.Message, "Database is down.")
+}
+
+func TestRouteHandlerWorkflowForEach(t *testing.T) {
+	var deleted []string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			deleted = append(deleted, r.URL.EscapedPath())
+			w.Write([]byte(`{"version": "0.6.6", "data": {"message": "Deleted 1 delay policies"}}`))
+			return
+		}
+		w.Write([]byte(`{"version": "0.6.6", "data": [{"name": "slow"}, {"name": "very/slow"}]}`))
+	})
+	defer server.Close()
+	m := setupConfig(*c, Configuration{Routes: []RouteConfig{{
+		Path: "/stubo/api/delete/delay_policy",
+		Steps: []StepConfig{
+			{
+				CallConfig: CallConfig{Target: "/stubo/api/v2/delay-policy/detail"},
+				Extract:    map[string]string{"version": "$.version"},
+			},
+			{
+				CallConfig: CallConfig{TargetMethod: "DELETE", Target: "/stubo/api/v2/delay-policy/objects/{policy}"},
+				ForEach:    "$.data[*].name",
+				As:         "policy",
+			},
+		},
+		Response: map[string]interface{}{
+			"version": "{version}",
+			"data":    map[string]interface{}{"message": "Deleted {policy_count} delay policies"},
+		},
+	}}})
+
+	req, err := http.NewRequest("GET", "/stubo/api/delete/delay_policy", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, len(deleted), 2)
+	expect(t, deleted[0], "/stubo/api/v2/delay-policy/objects/slow")
+	expect(t, deleted[1], "/stubo/api/v2/delay-policy/objects/very%2Fslow")
+	var body struct {
+		Version string            `json:"version"`
+		Data    map[string]string `json:"data"`
+	}
+	err = json.Unmarshal(respRec.Body.Bytes(), &body)
+	expect(t, err, nil)
+	expect(t, body.Version, "0.6.6")
+	expect(t, body.Data["message"], "Deleted 2 delay policies")
+}
+
+func TestRouteConfigValidateSteps(t *testing.T) {
+	step := StepConfig{CallConfig: CallConfig{Target: "/b"}}
+	expect(t, RouteConfig{Path: "/a", Steps: []StepConfig{step}}.validate(), nil)
+	refute(t, RouteConfig{Path: "/a", CallConfig: CallConfig{Target: "/b"}, Steps: []StepConfig{step}}.validate(), nil)
+	refute(t, RouteConfig{Path: "/a", Steps: []StepConfig{{CallConfig: CallConfig{Target: "/b"}, ForEach: "$.data"}}}.validate(), nil)
+	refute(t, RouteConfig{Path: "/a", Steps: []StepConfig{{CallConfig: CallConfig{Target: "/b"}, Accept: []int{42}}}}.validate(), nil)
+	refute(t, RouteConfig{Path: "/a", Steps: []StepConfig{{CallConfig: CallConfig{Target: "/b"}, Extract: map[string]string{"v": "data"}}}}.validate(), nil)
+}
+
+func TestRouteHandlerInvalidName(t *testing.T) {
+	m, server, call := routesSetup()
+	defer server.Close()
+
+	for _, scenario := range []string{"..", "."} {
+		call.path = ""
+		req, err := http.NewRequest("GET", "/stubo/api/get/stublist?scenario="+scenario, nil)
+		expect(t, err, nil)
+		respRec := httptest.NewRecorder()
+		m.ServeHTTP(respRec, req)
+
+		expect(t, respRec.Code, http.StatusBadRequest)
+		// Stubo is not called
+		expect(t, call.path, "")
+	}
+}
+
+func TestRouteHandlerBodyArray(t *testing.T) {
+	var body []byte
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Write([]byte(`{"version": "0.6.6", "data": {}}`))
+	})
+	defer server.Close()
+	m := setupConfig(*c, Configuration{Routes: []RouteConfig{{
+		Path: "/stubo/api/put/tags",
+		CallConfig: CallConfig{
+			TargetMethod: "PUT",
+			Target:       "/stubo/api/v2/scenarios/objects/{scenario}/tags",
+			Body: map[string]interface{}{
+				"tags": []interface{}{"{tag}", map[string]interface{}{"name": "{tag}"}},
+			},
+		},
+	}}})
+
+	req, err := http.NewRequest("GET", "/stubo/api/put/tags?scenario=first&tag=slow", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, string(body), `{"tags":["slow",{"name":"slow"}]}`)
+
+	// placeholders in arrays are required as well
+	body = nil
+	req, err = http.NewRequest("GET", "/stubo/api/put/tags?scenario=first", nil)
+	expect(t, err, nil)
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusBadRequest)
+	expect(t, body == nil, true)
+}
+
+func TestRouteHandlerSplitExtraColons(t *testing.T) {
+	m, server, call := routesSetup()
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", "/stubo/api/put/stub?session=first:first_1:extra", strings.NewReader(`{"request": {}}`))
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusBadRequest)
+	expect(t, call.path, "")
+}
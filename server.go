@@ -1,15 +1,11 @@
-package main
+package lgc
 
 import (
-	"encoding/json"
-	"flag"
 	"net/http"
-	"os"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/codegangsta/negroni"
 	"github.com/go-zoo/bone"
-	"github.com/meatballhat/negroni-logrus"
+	"github.com/rusenask/lgc/stubo"
 )
 
 // Configuration to hold stubo details
@@ -19,78 +15,118 @@ type Configuration struct {
 	StuboPort     string
 	Environment   string
 	Debug         bool
+	// CommandsDir - directory with commands files for exec/cmds calls
+	CommandsDir string
+	// LegacyStuboURI - legacy Stubo instance (e.g. "http://localhost:8002") that
+	// receives all calls which are not translated by LGC
+	LegacyStuboURI string
+	// Retry - retry policy for failed calls to Stubo
+	Retry stubo.RetryPolicy
+	// CircuitBreaker - stops calling Stubo after consecutive failures
+	CircuitBreaker stubo.CircuitBreakerConfig
+	// Timeouts - timeouts for calls to Stubo and LGC server
+	Timeouts TimeoutsConfig
+	// MaxBodyBytes - maximum size of stub and get/response bodies that are
+	// streamed through LGC, not limited if zero
+	MaxBodyBytes int64
+	// Upstreams - multiple Stubo nodes, used instead of StuboHost/StuboPort
+	Upstreams stubo.UpstreamsConfig
+	// Tenants - routing of teams to their own Stubo clusters
+	Tenants TenantsConfig
+	// Responses - response mode of translated legacy API calls by route (e.g.
+	// "get/stublist": "legacy"), API v2 responses are passed through by default
+	Responses map[string]string
+	// Arguments - split of URL query arguments into Stubo headers and
+	// arguments by route ("put/stub" or "get/response")
+	Arguments map[string]ArgumentsConfig
+	// Routes - legacy calls translated according to configuration, they take
+	// precedence over built-in translations
+	Routes []RouteConfig
+	// RoutesFile - JSON file with more routes
+	RoutesFile string
+	// SessionTTLMs - time after which LGC forgets sessions started through
+	// it, defaults to 24 hours
+	SessionTTLMs int
+
+	// HTTPClient - client for calls to Stubo, created from Timeouts if not
+	// set. Not read from configuration file, can be set when LGC is embedded
+	HTTPClient *http.Client `json:"-"`
+	// Logger - LGC logger, standard logrus logger is used if not set. Not read
+	// from configuration file, can be set when LGC is embedded
+	Logger *log.Logger `json:"-"`
+	// Transformers - transformers by legacy route path or pattern ("*" for all
+	// routes).
+	// Not read from configuration file, can be set when LGC is embedded
+	Transformers map[string][]Transformer `json:"-"`
 }
 
-// StuboConfig stores target Stubo instance details (protocol, hostname, port, etc..)
-var StuboConfig Configuration
+// ArgumentsConfig - URL query arguments of legacy route that are sent to
+// Stubo as headers, all other arguments are forwarded in Stubo URL query
+type ArgumentsConfig struct {
+	Headers []string
+}
 
-// StuboURI stores URI (e.g. "http://localhost:8001")
-var StuboURI string
+// StuboURI returns default Stubo URI (e.g. "http://localhost:8001"), used for
+// requests that don't belong to any tenant
+func (c Configuration) StuboURI() string {
+	return c.StuboProtocol + "://" + c.StuboHost + ":" + c.StuboPort
+}
 
-func main() {
-	// Output to stderr instead of stdout, could also be a file.
-	log.SetOutput(os.Stderr)
+// Version of LGC, can be set during build:
+// go build -ldflags "-X github.com/rusenask/lgc.Version=1.0.0" ./cmd/lgc
+var Version = "dev"
 
-	// getting configuration
-	file, err := os.Open("conf.json")
+// getRouter returns router with all translated legacy API calls
+func getRouter(h HandlerHTTPClient) (*bone.Mux, error) {
+	err := validateResponseModes(h.config.Responses)
 	if err != nil {
-		log.Panic("Failed to open configuration file, quiting server.")
+		return nil, err
 	}
-	decoder := json.NewDecoder(file)
-	StuboConfig = Configuration{}
-	err = decoder.Decode(&StuboConfig)
+	err = validateArguments(h.config.Arguments)
 	if err != nil {
-		log.WithFields(log.Fields{"Error": err.Error()}).Panic("Failed to read configuration")
+		return nil, err
 	}
-	// configuring logger based on environment settings
-	if StuboConfig.Environment == "production" {
-		// Log as JSON instead of the default ASCII formatter.
-		log.SetFormatter(&log.JSONFormatter{})
-		// TODO: also, write to file, probably log file path should also be configurable
-	} else {
-		// The TextFormatter is default
-		log.SetFormatter(&log.TextFormatter{})
+	routes, err := h.config.routes()
+	if err != nil {
+		return nil, err
 	}
+	mux := bone.New()
+	// configured routes are added first, so they override built-in ones
+	h.addRoutes(mux, routes)
+	mux.Post("/stubo/api/put/stub", h.handle(h.putStubHandler))
+	mux.Post("/stubo/api/get/response", h.handle(h.getStubResponseHandler))
+	mux.Get("/stubo/api/get/stublist", h.handle(h.stublistHandler))
+	mux.Get("/stubo/api/delete/stubs", h.handle(h.deleteStubsHandler))
+	mux.Get("/stubo/api/put/delay_policy", h.handle(h.putDelayPolicyHandler))
+	mux.Get("/stubo/api/get/delay_policy", h.handle(h.getDelayPolicyHandler))
+	mux.Get("/stubo/api/delete/delay_policy", h.handle(h.deleteDelayPolicyHandler))
+	mux.Get("/stubo/api/begin/session", h.handle(h.beginSessionHandler))
+	mux.Get("/stubo/api/end/sessions", h.handle(h.endSessionsHandler))
+	mux.Get("/stubo/api/end/session", h.handle(h.endSessionHandler))
+	mux.Get("/stubo/api/get/scenarios", h.handle(h.getScenariosHandler))
+	mux.Get("/stubo/api/get/version", h.handle(h.getVersionHandler))
+	mux.Get("/stubo/api/get/status", h.handle(h.getStatusHandler))
+	mux.Get("/stubo/api/exec/cmds", h.handle(h.execCmdsHandler(mux)))
+	mux.Post("/stubo/api/exec/cmds", h.handle(h.execCmdsHandler(mux)))
+	mux.Get("/stubo/api/get/export", h.handle(h.exportHandler))
+	mux.Get("/stubo/api/get/stubcount", h.handle(h.stubCountHandler))
+	mux.Get("/stubo/api/put/scenarios", h.handle(h.renameScenarioHandler))
+	mux.Post("/stubo/api/put/scenarios", h.handle(h.renameScenarioHandler))
+	mux.Get("/stubo/api/put/scenarios/:scenario", h.handle(h.renameScenarioHandler))
+	mux.Post("/stubo/api/put/scenarios/:scenario", h.handle(h.renameScenarioHandler))
+	mux.Get("/lgc/admin/circuit_breaker", h.handle(h.circuitBreakerHandler))
+	mux.Get("/lgc/admin/upstreams", h.handle(h.upstreamsHandler))
 
-	if StuboConfig.Debug == true {
-		log.SetLevel(log.DebugLevel)
-		log.Info("Starting server with debug mode initiated...")
+	// untranslated calls go to legacy Stubo, if it is configured, otherwise
+	// they get legacy error envelope
+	if h.config.LegacyStuboURI != "" {
+		legacy, err := newLegacyProxy(h.config.LegacyStuboURI, h.logger(), h.transformers)
+		if err != nil {
+			return nil, err
+		}
+		mux.NotFound(legacy.ServeHTTP)
+	} else {
+		mux.NotFound(h.handle(h.notFoundHandler).ServeHTTP)
 	}
-	// looking for option args when starting App
-	// like ./lgc -port=":3000" would start on port 3000
-	var port = flag.String("port", ":3000", "Server port")
-	flag.Parse() // parse the flag
-
-	// assign StuboURI
-	StuboURI = StuboConfig.StuboProtocol + "://" + StuboConfig.StuboHost + ":" + StuboConfig.StuboPort
-
-	log.WithFields(log.Fields{
-		"StuboHost": StuboConfig.StuboHost,
-		"StuboPort": StuboConfig.StuboPort,
-		"StuboURI":  StuboURI,
-		"ProxyPort": port,
-	}).Info("LGC is starting")
-
-	client := &Client{&http.Client{}}
-	mux := getRouter(HandlerHTTPClient{*client})
-
-	n := negroni.Classic()
-	n.Use(negronilogrus.NewMiddleware())
-	n.UseHandler(mux)
-	n.Run(*port)
-}
-
-func getRouter(h HandlerHTTPClient) *bone.Mux {
-	mux := bone.New()
-	mux.Post("/stubo/api/put/stub", http.HandlerFunc(h.putStubHandler))
-	mux.Post("/stubo/api/get/response", http.HandlerFunc(h.getStubResponseHandler))
-	mux.Get("/stubo/api/get/stublist", http.HandlerFunc(h.stublistHandler))
-	mux.Get("/stubo/api/delete/stubs", http.HandlerFunc(h.deleteStubsHandler))
-	mux.Get("/stubo/api/put/delay_policy", http.HandlerFunc(h.putDelayPolicyHandler))
-	mux.Get("/stubo/api/get/delay_policy", http.HandlerFunc(h.getDelayPolicyHandler))
-	mux.Get("/stubo/api/delete/delay_policy", http.HandlerFunc(h.deleteDelayPolicyHandler))
-	mux.Get("/stubo/api/begin/session", http.HandlerFunc(h.beginSessionHandler))
-	mux.Get("/stubo/api/end/sessions", http.HandlerFunc(h.endSessionsHandler))
-	mux.Get("/stubo/api/get/scenarios", http.HandlerFunc(h.getScenariosHandler))
-	return mux
+	return mux, nil
 }
@@ -0,0 +1,132 @@
+package lgc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rusenask/lgc/stubo"
+)
+
+// SessionInfo holds details about session that was started through LGC
+type SessionInfo struct {
+	Scenario string
+	Mode     string
+	Started  time.Time
+}
+
+// defaultSessionTTL - time after which sessions are forgotten, so sessions
+// that were never ended don't stay in registry forever
+const defaultSessionTTL = 24 * time.Hour
+
+// SessionRegistry keeps track of session to scenario ownership. Legacy API
+// calls such as end/session only provide session name, while API v2 needs
+// scenario name as well. Sessions are kept per tenant, since tenants can use
+// the same session names, and are forgotten after TTL
+type SessionRegistry struct {
+	mu        sync.RWMutex
+	sessions  map[sessionKey]SessionInfo
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+// sessionKey identifies session of a tenant, tenant is empty for calls that
+// don't belong to a tenant
+type sessionKey struct {
+	tenant  string
+	session string
+}
+
+// NewSessionRegistry returns empty session registry, sessions are forgotten
+// after given TTL
+func NewSessionRegistry(ttl time.Duration) *SessionRegistry {
+	return &SessionRegistry{
+		sessions:  make(map[sessionKey]SessionInfo),
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}
+}
+
+// Add registers tenant's session as owned by scenario
+func (s *SessionRegistry) Add(tenant, session, scenario, mode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sessions[sessionKey{tenant, session}] = SessionInfo{
+		Scenario: scenario,
+		Mode:     mode,
+		Started:  now,
+	}
+	// expired sessions are removed at most once per TTL
+	if now.Sub(s.lastSweep) >= s.ttl {
+		for key, info := range s.sessions {
+			if s.expired(info, now) {
+				delete(s.sessions, key)
+			}
+		}
+		s.lastSweep = now
+	}
+}
+
+// Get returns details of tenant's session, second value is false if session
+// is unknown or expired
+func (s *SessionRegistry) Get(tenant, session string) (SessionInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, ok := s.sessions[sessionKey{tenant, session}]
+	if !ok || s.expired(info, time.Now()) {
+		return SessionInfo{}, false
+	}
+	return info, true
+}
+
+// Remove deletes tenant's session from registry
+func (s *SessionRegistry) Remove(tenant, session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionKey{tenant, session})
+}
+
+// RemoveScenario deletes all tenant's sessions that belong to given scenario
+func (s *SessionRegistry) RemoveScenario(tenant, scenario string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, info := range s.sessions {
+		if key.tenant == tenant && info.Scenario == scenario {
+			delete(s.sessions, key)
+		}
+	}
+}
+
+// Len returns number of registered sessions, expired sessions are not counted
+func (s *SessionRegistry) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	n := 0
+	for _, info := range s.sessions {
+		if !s.expired(info, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// expired checks whether session was started more than TTL ago
+func (s *SessionRegistry) expired(info SessionInfo, now time.Time) bool {
+	return s.ttl > 0 && now.Sub(info.Started) > s.ttl
+}
+
+// findSessionScenario looks for scenario that holds given session in
+// API v2 scenario details response. Full scenario name with host prefix (e.g.
+// "localhost:scenario_1") is returned, so sessions of scenarios that belong to
+// other hosts are ended in the right scenario.
+func findSessionScenario(details stubo.ScenariosDetailResponse, session string) (string, bool) {
+	for _, scenario := range details.Data {
+		for _, s := range scenario.Sessions {
+			if s.Name == session {
+				return scenario.Name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,50 @@
+package lgc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionRegistryTenants(t *testing.T) {
+	sessions := NewSessionRegistry(defaultSessionTTL)
+	sessions.Add("team_a", "session_1", "scenario_a", "record")
+	sessions.Add("team_b", "session_1", "scenario_b", "record")
+
+	// same session name of different tenants
+	info, ok := sessions.Get("team_a", "session_1")
+	expect(t, ok, true)
+	expect(t, info.Scenario, "scenario_a")
+	info, ok = sessions.Get("team_b", "session_1")
+	expect(t, ok, true)
+	expect(t, info.Scenario, "scenario_b")
+	_, ok = sessions.Get("", "session_1")
+	expect(t, ok, false)
+
+	sessions.Remove("team_a", "session_1")
+	_, ok = sessions.Get("team_a", "session_1")
+	expect(t, ok, false)
+	_, ok = sessions.Get("team_b", "session_1")
+	expect(t, ok, true)
+
+	sessions.RemoveScenario("team_a", "scenario_b")
+	expect(t, sessions.Len(), 1)
+	sessions.RemoveScenario("team_b", "scenario_b")
+	expect(t, sessions.Len(), 0)
+}
+
+func TestSessionRegistryTTL(t *testing.T) {
+	sessions := NewSessionRegistry(20 * time.Millisecond)
+	sessions.Add("", "session_1", "scenario_1", "record")
+	_, ok := sessions.Get("", "session_1")
+	expect(t, ok, true)
+
+	time.Sleep(30 * time.Millisecond)
+	_, ok = sessions.Get("", "session_1")
+	expect(t, ok, false)
+	// expired sessions are not counted before they are removed
+	expect(t, sessions.Len(), 0)
+
+	// expired sessions are removed when new ones are added
+	sessions.Add("", "session_2", "scenario_1", "record")
+	expect(t, sessions.Len(), 1)
+}
@@ -0,0 +1,627 @@
+package stubo
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+)
+
+// scenarioPath returns API v2 path of scenario object, e.g.
+// /stubo/api/v2/scenarios/objects/{scenario_name}/stubs. Scenario name is
+// escaped, so names with "/", "?" or "#" don't break routing
+func scenarioPath(scenario, object string) string {
+	path := "/stubo/api/v2/scenarios/objects/" + url.PathEscape(scenario)
+	if object != "" {
+		path += "/" + object
+	}
+	return path
+}
+
+// affinityKey returns "scenario:session" key of session calls. Host prefix of
+// scenario name (e.g. "localhost:" in "localhost:first", as Stubo lists
+// scenarios) is removed, so calls of the same session go to the same node no
+// matter which form of scenario name they use
+func affinityKey(scenario, session string) string {
+	if idx := strings.Index(scenario, ":"); idx != -1 {
+		scenario = scenario[idx+1:]
+	}
+	return scenario + ":" + session
+}
+
+// delayPolicyPath returns API v2 path of delay policy object
+func delayPolicyPath(name string) string {
+	return "/stubo/api/v2/delay-policy/objects/" + url.PathEscape(name)
+}
+
+// validateSession validates scenario and session names of session request
+func validateSession(op string, req SessionRequest) error {
+	if err := validateName(op, "scenario name", req.Scenario); err != nil {
+		return err
+	}
+	return validateName(op, "session name", req.Session)
+}
+
+// stubParams validates scenario and session names and prepares params for
+// calls to scenario stubs
+func stubParams(op string, req StubRequest) (params, error) {
+	var s params
+	if req.Session == "" {
+		return s, invalid(op, "session key not supplied")
+	}
+	if req.Scenario == "" {
+		return s, invalid(op, "scenario or session not supplied")
+	}
+	if err := validateName(op, "session name", req.Session); err != nil {
+		return s, err
+	}
+	if err := validateName(op, "scenario name", req.Scenario); err != nil {
+		return s, err
+	}
+	headers := map[string]string{"session": req.Session}
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	s.path = scenarioPath(req.Scenario, "stubs")
+	if req.Args != "" {
+		s.path += "?" + req.Args
+	}
+	s.headers = headers
+	s.affinity = affinityKey(req.Scenario, req.Session)
+	return s, nil
+}
+
+// GetResponse looks for stub matching request body in scenario session and
+// returns its response
+func (c *Client) GetResponse(ctx context.Context, req StubRequest) (*Response, error) {
+	s, err := stubParams("GetResponse", req)
+	if err != nil {
+		return nil, err
+	}
+	s.method = "POST"
+
+	// assigning body in bytes
+	s.bodyBytes = req.Body
+
+	return c.makeRequest(ctx, "GetResponse", s)
+}
+
+// GetResponseStream streams request body to Stubo, caller must close
+// response body
+func (c *Client) GetResponseStream(ctx context.Context, req StubRequest, body io.Reader) (*http.Response, error) {
+	s, err := stubParams("GetResponse", req)
+	if err != nil {
+		return nil, err
+	}
+	s.method = "POST"
+	s.bodyReader = body
+
+	return c.streamRequest(ctx, "GetResponse", s)
+}
+
+// PutStub transparently passes stub body to Stubo
+func (c *Client) PutStub(ctx context.Context, req StubRequest) (*Response, error) {
+	s, err := stubParams("PutStub", req)
+	if err != nil {
+		return nil, err
+	}
+	s.method = "PUT"
+
+	// assigning body in bytes
+	s.bodyBytes = req.Body
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"scenario":      req.Scenario,
+		"session":       req.Session,
+		"urlPath":       s.path,
+		"headers":       "",
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Adding stub to scenario")
+
+	return c.makeRequest(ctx, "PutStub", s)
+}
+
+// PutStubStream streams stub body to Stubo, caller must close response body
+func (c *Client) PutStubStream(ctx context.Context, req StubRequest, body io.Reader) (*http.Response, error) {
+	s, err := stubParams("PutStub", req)
+	if err != nil {
+		return nil, err
+	}
+	s.method = "PUT"
+	s.bodyReader = body
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"scenario":      req.Scenario,
+		"session":       req.Session,
+		"urlPath":       s.path,
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Streaming stub to scenario")
+
+	return c.streamRequest(ctx, "PutStub", s)
+}
+
+// GetScenarioStubs calls to Stubo's REST API
+// /stubo/api/v2/scenarios/objects/{scenario_name}/stubs
+func (c *Client) GetScenarioStubs(ctx context.Context, scenario string) (*Response, error) {
+	if err := validateName("GetScenarioStubs", "scenario name", scenario); err != nil {
+		return nil, err
+	}
+	var s params
+	s.path = scenarioPath(scenario, "stubs")
+	s.method = "GET"
+	s.bulk = true
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          scenario,
+		"urlPath":       s.path,
+		"headers":       "",
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Getting scenario stubs")
+
+	return c.makeRequest(ctx, "GetScenarioStubs", s)
+}
+
+// DeleteScenarioStubs deletes scenario stubs, optional "force" defaults to
+// false and "targetHost" can specify another host
+func (c *Client) DeleteScenarioStubs(ctx context.Context, req DeleteStubsRequest) (*Response, error) {
+	if err := validateName("DeleteScenarioStubs", "scenario name", req.Scenario); err != nil {
+		return nil, err
+	}
+	var s params
+	s.path = scenarioPath(req.Scenario, "stubs")
+	// creating MAP for headers
+	headers := make(map[string]string)
+	if req.Force != "" {
+		headers["force"] = req.Force
+	}
+	if req.TargetHost != "" {
+		headers["target_host"] = req.TargetHost
+	}
+	s.headers = headers
+	s.method = "DELETE"
+	s.bulk = true
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          req.Scenario,
+		"urlPath":       s.path,
+		"headers":       s.headers,
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Deleting scenario stubs")
+
+	return c.makeRequest(ctx, "DeleteScenarioStubs", s)
+}
+
+// GetDelayPolicy gets specified delay policy
+// /stubo/api/v2/delay-policy/objects/{name}
+func (c *Client) GetDelayPolicy(ctx context.Context, name string) (*Response, error) {
+	if err := validateName("GetDelayPolicy", "delay policy name", name); err != nil {
+		return nil, err
+	}
+	var s params
+	s.path = delayPolicyPath(name)
+	s.method = "GET"
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          name,
+		"urlPath":       s.path,
+		"headers":       "",
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Getting specified delay policy")
+
+	return c.makeRequest(ctx, "GetDelayPolicy", s)
+}
+
+// GetDelayPolicies gets all delay policies
+// /stubo/api/v2/delay-policy/detail
+func (c *Client) GetDelayPolicies(ctx context.Context) (*Response, error) {
+	var s params
+	s.path = "/stubo/api/v2/delay-policy/detail"
+	s.method = "GET"
+	s.bulk = true
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          "",
+		"urlPath":       s.path,
+		"headers":       "",
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Getting all delay policies")
+
+	return c.makeRequest(ctx, "GetDelayPolicies", s)
+}
+
+// PutDelayPolicy creates or updates delay policy
+func (c *Client) PutDelayPolicy(ctx context.Context, policy DelayPolicyRequest) (*Response, error) {
+	// missing name is reported by Stubo together with other missing fields
+	if policy.Name != "" {
+		if err := validateName("PutDelayPolicy", "delay policy name", policy.Name); err != nil {
+			return nil, err
+		}
+	}
+	body, err := jsonBody("PutDelayPolicy", policy)
+	if err != nil {
+		return nil, err
+	}
+	var s params
+	s.body = body
+	s.path = "/stubo/api/v2/delay-policy"
+	s.method = "PUT"
+
+	return c.makeRequest(ctx, "PutDelayPolicy", s)
+}
+
+// DeleteDelayPolicy deletes specified delay policy
+func (c *Client) DeleteDelayPolicy(ctx context.Context, name string) (*Response, error) {
+	if err := validateName("DeleteDelayPolicy", "delay policy name", name); err != nil {
+		return nil, err
+	}
+	var s params
+	s.path = delayPolicyPath(name)
+	s.method = "DELETE"
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          name,
+		"urlPath":       s.path,
+		"headers":       "",
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Deleting specified delay policy")
+
+	return c.makeRequest(ctx, "DeleteDelayPolicy", s)
+}
+
+// BeginSession begins session in record or playback mode
+func (c *Client) BeginSession(ctx context.Context, req SessionRequest) (*Response, error) {
+	if err := validateSession("BeginSession", req); err != nil {
+		return nil, err
+	}
+	body, err := jsonBody("BeginSession", map[string]interface{}{
+		"begin":   nil,
+		"session": req.Session,
+		"mode":    req.Mode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var s params
+	s.body = body
+	s.path = scenarioPath(req.Scenario, "action")
+	s.method = "POST"
+	s.affinity = affinityKey(req.Scenario, req.Session)
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"scenario":      req.Scenario,
+		"session":       req.Session,
+		"urlPath":       s.path,
+		"headers":       "",
+		"body":          s.body,
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Begin session")
+
+	return c.makeRequest(ctx, "BeginSession", s)
+}
+
+// CreateScenario creates scenario, Stubo responds with 422 status code if
+// scenario already exists
+func (c *Client) CreateScenario(ctx context.Context, scenario string) (*Response, error) {
+	if err := validateName("CreateScenario", "scenario name", scenario); err != nil {
+		return nil, err
+	}
+	body, err := jsonBody("CreateScenario", map[string]string{"scenario": scenario})
+	if err != nil {
+		return nil, err
+	}
+	var s params
+	s.body = body
+	s.path = "/stubo/api/v2/scenarios"
+	s.method = "PUT"
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          scenario,
+		"urlPath":       s.path,
+		"headers":       "",
+		"body":          s.body,
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Creating scenario")
+
+	return c.makeRequest(ctx, "CreateScenario", s)
+}
+
+// DeleteScenario deletes specified scenario
+func (c *Client) DeleteScenario(ctx context.Context, scenario string) (*Response, error) {
+	if err := validateName("DeleteScenario", "scenario name", scenario); err != nil {
+		return nil, err
+	}
+	var s params
+	s.path = scenarioPath(scenario, "")
+	s.method = "DELETE"
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          scenario,
+		"urlPath":       s.path,
+		"headers":       "",
+		"body":          "",
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Deleting scenario")
+
+	return c.makeRequest(ctx, "DeleteScenario", s)
+}
+
+// GetScenariosDetail gets and returns all scenarios with details
+func (c *Client) GetScenariosDetail(ctx context.Context) (*Response, error) {
+	var s params
+	s.path = "/stubo/api/v2/scenarios/detail"
+	s.method = "GET"
+	s.bulk = true
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          "",
+		"urlPath":       s.path,
+		"headers":       "",
+		"body":          "",
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Getting scenario details")
+
+	return c.makeRequest(ctx, "GetScenariosDetail", s)
+}
+
+// GetScenarios gets and returns all scenarios
+func (c *Client) GetScenarios(ctx context.Context) (*Response, error) {
+	var s params
+	s.path = "/stubo/api/v2/scenarios"
+	s.method = "GET"
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          "",
+		"urlPath":       s.path,
+		"headers":       "",
+		"body":          "",
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Getting scenarios")
+
+	return c.makeRequest(ctx, "GetScenarios", s)
+}
+
+// EndSessions ends all specified scenario sessions
+func (c *Client) EndSessions(ctx context.Context, scenario string) (*Response, error) {
+	if err := validateName("EndSessions", "scenario name", scenario); err != nil {
+		return nil, err
+	}
+	body, err := jsonBody("EndSessions", map[string]string{"end": "sessions"})
+	if err != nil {
+		return nil, err
+	}
+	var s params
+	s.body = body
+	s.path = scenarioPath(scenario, "action")
+	s.method = "POST"
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"name":          scenario,
+		"urlPath":       s.path,
+		"headers":       "",
+		"body":          s.body,
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Ending sessions")
+
+	return c.makeRequest(ctx, "EndSessions", s)
+}
+
+// EndSession ends specified session in given scenario
+func (c *Client) EndSession(ctx context.Context, req SessionRequest) (*Response, error) {
+	if err := validateSession("EndSession", req); err != nil {
+		return nil, err
+	}
+	body, err := jsonBody("EndSession", map[string]interface{}{
+		"end":     nil,
+		"session": req.Session,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var s params
+	s.body = body
+	s.path = scenarioPath(req.Scenario, "action")
+	s.method = "POST"
+	s.affinity = affinityKey(req.Scenario, req.Session)
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"scenario":      req.Scenario,
+		"session":       req.Session,
+		"urlPath":       s.path,
+		"headers":       "",
+		"body":          s.body,
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Ending session")
+
+	return c.makeRequest(ctx, "EndSession", s)
+}
+
+// GetVersion calls Stubo and returns version field from response envelope
+func (c *Client) GetVersion(ctx context.Context) (string, error) {
+	var s params
+	s.path = "/stubo/api/v2/scenarios"
+	s.method = "GET"
+
+	// setting logger
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"urlPath":       s.path,
+		"requestMethod": s.method,
+		"func":          method,
+	}).Debug("Getting Stubo version")
+
+	response, err := c.makeRequest(ctx, "GetVersion", s)
+	if err != nil {
+		return "", err
+	}
+	var envelope struct {
+		Version string `json:"version"`
+	}
+	err = response.Decode(&envelope)
+	if err != nil {
+		return "", err
+	}
+	return envelope.Version, nil
+}
+
+// ListScenarios gets all scenarios and decodes Stubo response
+func (c *Client) ListScenarios(ctx context.Context) (*ScenariosResponse, error) {
+	response, err := c.GetScenarios(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var scenarios ScenariosResponse
+	err = response.Decode(&scenarios)
+	if err != nil {
+		return nil, err
+	}
+	return &scenarios, nil
+}
+
+// ListScenariosDetail gets all scenarios with their sessions and decodes
+// Stubo response
+func (c *Client) ListScenariosDetail(ctx context.Context) (*ScenariosDetailResponse, error) {
+	response, err := c.GetScenariosDetail(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var details ScenariosDetailResponse
+	err = response.Decode(&details)
+	if err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// ListScenarioStubs gets scenario stubs and decodes Stubo response
+func (c *Client) ListScenarioStubs(ctx context.Context, scenario string) (*ScenarioStubsResponse, error) {
+	response, err := c.GetScenarioStubs(ctx, scenario)
+	if err != nil {
+		return nil, err
+	}
+	var stubs ScenarioStubsResponse
+	err = response.Decode(&stubs)
+	if err != nil {
+		return nil, err
+	}
+	return &stubs, nil
+}
+
+// ListDelayPolicies gets all delay policies and decodes Stubo response
+func (c *Client) ListDelayPolicies(ctx context.Context) (*DelayPolicyResponse, error) {
+	response, err := c.GetDelayPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var policies DelayPolicyResponse
+	err = response.Decode(&policies)
+	if err != nil {
+		return nil, err
+	}
+	return &policies, nil
+}
+
+// BeginSessionStatus begins session and decodes session status from Stubo
+// response
+func (c *Client) BeginSessionStatus(ctx context.Context, req SessionRequest) (*SessionStatusResponse, error) {
+	response, err := c.BeginSession(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var status SessionStatusResponse
+	err = response.Decode(&status)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Request is an API v2 call that is not covered by other Client methods,
+// e.g. legacy route translated from configuration
+type Request struct {
+	// Op - name of the call used in errors and logs, defaults to "Do"
+	Op     string
+	Method string
+	// Path - API v2 path with optional URL query, path segments must be
+	// escaped by the caller
+	Path    string
+	Headers map[string]string
+	Body    []byte
+	// Affinity - "scenario:session" key, calls with the same key go to the
+	// same Stubo node
+	Affinity string
+	// Bulk - call gets bulk timeout
+	Bulk bool
+}
+
+// requestParams converts request into params
+func requestParams(req Request) (string, params) {
+	op := req.Op
+	if op == "" {
+		op = "Do"
+	}
+	var s params
+	s.method = req.Method
+	s.path = req.Path
+	s.headers = req.Headers
+	s.bodyBytes = req.Body
+	s.affinity = req.Affinity
+	s.bulk = req.Bulk
+	return op, s
+}
+
+// Do makes API v2 call and reads Stubo response
+func (c *Client) Do(ctx context.Context, req Request) (*Response, error) {
+	op, s := requestParams(req)
+	return c.makeRequest(ctx, op, s)
+}
+
+// DoStream makes API v2 call with body streamed to Stubo, caller must close
+// response body
+func (c *Client) DoStream(ctx context.Context, req Request, body io.Reader) (*http.Response, error) {
+	op, s := requestParams(req)
+	s.bodyReader = body
+	return c.streamRequest(ctx, op, s)
+}
@@ -0,0 +1,309 @@
+package stubo
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+var ctx = context.Background()
+
+func TestGetScenarioStubs(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"name": "scenario1"}]}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	name := "scenario_1"
+	response, err := c.GetScenarioStubs(ctx, name)
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 52)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestDeleteScenarioStubs(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"name": "scenario1"}]}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	data := DeleteStubsRequest{
+		Scenario:   "scenario_1",
+		Force:      "true",
+		TargetHost: "somehost",
+	}
+	response, err := c.DeleteScenarioStubs(ctx, data)
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 52)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestDeleteScenarioStubsFail(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"name": "scenario1"}]}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	var data DeleteStubsRequest
+	_, err := c.DeleteScenarioStubs(ctx, data)
+	refute(t, err, nil)
+	expect(t, StatusCode(err), 400)
+}
+
+func TestGetDelayPolicy(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"policy": "policy_1"}]}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	name := "scenario_1"
+	response, err := c.GetDelayPolicy(ctx, name)
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 53)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestGetDelayPolicies(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	response, err := c.GetDelayPolicies(ctx)
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 45)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestDeleteDelayPolicy(t *testing.T) {
+	testdata := `data response`
+	server, c := testTools(200, testdata)
+	defer server.Close()
+	name := "delay_policy_name"
+	response, err := c.DeleteDelayPolicy(ctx, name)
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestBeginSession(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	response, err := c.BeginSession(ctx, SessionRequest{Scenario: "scenario", Session: "session", Mode: "record"})
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 45)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestCreateScenario(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(201, testData)
+	defer server.Close()
+	response, err := c.CreateScenario(ctx, "scenario_1")
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 45)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestCreateScenarioExists(t *testing.T) {
+	testData := `{"version":"1.2.3","error": {"code": 422, "message": "Scenario already exists"}}`
+	server, c := testTools(422, testData)
+	defer server.Close()
+	_, err := c.CreateScenario(ctx, "scenario_1")
+	refute(t, err, nil)
+	stuboErr, ok := err.(*Error)
+	expect(t, ok, true)
+	expect(t, stuboErr.Op, "CreateScenario")
+	expect(t, stuboErr.StatusCode, 422)
+	expect(t, strings.Contains(string(stuboErr.Body), "already exists"), true)
+	refute(t, stuboErr.Envelope, nil)
+	expect(t, stuboErr.Envelope.Error.Code, 422)
+	expect(t, stuboErr.Envelope.Error.Message, "Scenario already exists")
+	expect(t, strings.Contains(stuboErr.Error(), "Scenario already exists"), true)
+}
+
+func TestGetScenariosDetail(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(201, testData)
+	defer server.Close()
+	response, err := c.GetScenariosDetail(ctx)
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 45)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestGetScenarios(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(201, testData)
+	defer server.Close()
+	response, err := c.GetScenarios(ctx)
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 45)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestEndSessions(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(201, testData)
+	defer server.Close()
+	response, err := c.EndSessions(ctx, "scenario")
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 45)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestMakeRequest(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(201, testData)
+	defer server.Close()
+	// prepare struct
+	path := "/stubo/api/v2/scenarios/objects/some_scenario/action"
+	var s params
+	s.body = `{"end": "sessions"}`
+	s.path = path
+	s.method = "POST"
+	response, err := c.makeRequest(ctx, "EndSessions", s)
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 45)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestMakeRequestFail(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(201, testData)
+	defer server.Close()
+	var s params
+	c.StuboURI = "malformed url"
+	_, err := c.makeRequest(ctx, "GetScenarios", s)
+	refute(t, err, nil)
+}
+
+func TestPutStub(t *testing.T) {
+	testData := `{  "version": "0.6.6",
+								  "data": {
+								        "message": {
+								            "status": "updated", "msg": "Updated with stateful response",
+								            "key": "55dc6cc1938fbef2e62d875c"}
+								          }
+								  }`
+	server, c := testTools(201, testData)
+	defer server.Close()
+
+	req := StubRequest{
+		Scenario: "scenario1",
+		Session:  "session_name",
+		Args:     "args=1&arg2=2",
+		Headers:  map[string]string{"stateful": "true"},
+		Body:     []byte("some body here"),
+	}
+	// putting stub
+	response, err := c.PutStub(ctx, req)
+	expect(t, err, nil)
+	resp := string(response.Body)
+
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestPutStubFailNoSession(t *testing.T) {
+	testData := `foo`
+	server, c := testTools(201, testData)
+	defer server.Close()
+
+	req := StubRequest{
+		Scenario: "scenario1",
+		Args:     "args=1&arg2=2",
+		Headers:  map[string]string{"stateful": "true"},
+		Body:     []byte("some body here"),
+	}
+	// putting stub, omitting session
+	_, err := c.PutStub(ctx, req)
+	refute(t, err, nil)
+	expect(t, StatusCode(err), 400)
+	expect(t, strings.Contains(err.Error(), "session key not supplied"), true)
+}
+
+func TestPutStubFailNoScenario(t *testing.T) {
+	testData := `foo`
+	server, c := testTools(200, testData)
+	defer server.Close()
+
+	req := StubRequest{
+		Session: "some_session",
+		Args:    "args=1&arg2=2",
+		Headers: map[string]string{"stateful": "true"},
+		Body:    []byte("some body here"),
+	}
+	// putting stub, omitting scenario
+	_, err := c.PutStub(ctx, req)
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), "scenario or session not supplied"), true)
+}
+
+func TestEndSession(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	response, err := c.EndSession(ctx, SessionRequest{Scenario: "scenario", Session: "session"})
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, len(response.Body), 45)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestDeleteScenario(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	response, err := c.DeleteScenario(ctx, "scenario")
+	expect(t, err, nil)
+	resp := string(response.Body)
+	expect(t, response.StatusCode, 200)
+	expect(t, strings.Contains(resp, "data"), true)
+}
+
+func TestGetVersion(t *testing.T) {
+	testData := `{"version":"1.2.3","data": []}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	version, err := c.GetVersion(ctx)
+	expect(t, version, "1.2.3")
+	expect(t, err, nil)
+}
+
+func TestListScenarios(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"name": "localhost:scenario_1",
+		"scenarioRef": "/stubo/api/v2/scenarios/objects/localhost:scenario_1"}]}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	scenarios, err := c.ListScenarios(ctx)
+	expect(t, err, nil)
+	expect(t, scenarios.Version, "1.2.3")
+	expect(t, len(scenarios.Data), 1)
+	expect(t, scenarios.Data[0].Name, "localhost:scenario_1")
+	expect(t, scenarios.Data[0].Ref, "/stubo/api/v2/scenarios/objects/localhost:scenario_1")
+}
+
+func TestListScenarioStubsInvalidJSON(t *testing.T) {
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	stubs, err := c.ListScenarioStubs(ctx, "scenario_1")
+	expect(t, stubs == nil, true)
+	expect(t, StatusCode(err), 502)
+	stuboErr, ok := err.(*Error)
+	expect(t, ok, true)
+	expect(t, stuboErr.Op, "GetScenarioStubs")
+}
+
+func TestBeginSessionStatus(t *testing.T) {
+	testData := `{"version": "1.2.3", "data": {"status": "record", "session": "session_1",
+		"scenario": "localhost:scenario_1", "message": "Record mode initiated...."}}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	status, err := c.BeginSessionStatus(ctx, SessionRequest{Scenario: "scenario_1", Session: "session_1", Mode: "record"})
+	expect(t, err, nil)
+	expect(t, status.Data.Status, "record")
+	expect(t, status.Data.Session, "session_1")
+	expect(t, status.Data.Scenario, "localhost:scenario_1")
+}
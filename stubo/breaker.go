@@ -0,0 +1,169 @@
+package stubo
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+)
+
+// ErrCircuitOpen is returned instead of calling Stubo while circuit breaker is open
+var ErrCircuitOpen = errors.New("Stubo is unavailable, circuit breaker is open")
+
+// circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// CircuitBreakerConfig - circuit breaker settings, breaker is disabled when
+// FailureThreshold is not set
+type CircuitBreakerConfig struct {
+	// FailureThreshold - number of consecutive failures that opens the circuit
+	FailureThreshold int
+	// CoolDownMs - time in milliseconds before calls to Stubo are allowed again
+	CoolDownMs int
+}
+
+// CircuitBreaker stops calls to Stubo after a number of consecutive failures.
+// After cool-down period single probe call is allowed (half-open state), if it
+// succeeds - circuit is closed again, otherwise it stays open for another period.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	coolDown  time.Duration
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	logger    *log.Logger
+}
+
+// CircuitBreakerStatus describes circuit breaker state
+type CircuitBreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	FailureThreshold    int        `json:"failure_threshold"`
+	CoolDownMs          int64      `json:"cool_down_ms"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+}
+
+// NewCircuitBreaker returns circuit breaker for given configuration or nil if
+// circuit breaker is disabled
+func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.FailureThreshold < 1 {
+		return nil
+	}
+	return &CircuitBreaker{
+		threshold: cfg.FailureThreshold,
+		coolDown:  time.Duration(cfg.CoolDownMs) * time.Millisecond,
+		state:     breakerClosed,
+	}
+}
+
+// SetLogger sets logger for circuit breaker state changes
+func (b *CircuitBreaker) SetLogger(logger *log.Logger) {
+	if b != nil {
+		b.logger = logger
+	}
+}
+
+// Allow checks whether call to Stubo can be made
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.coolDown {
+			return false
+		}
+		util.LoggerOrDefault(b.logger).WithFields(log.Fields{
+			"func": util.Trace(),
+		}).Info("Circuit breaker is half-open, probing Stubo")
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		// only one probe call at a time
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success records successful call
+func (b *CircuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerClosed {
+		util.LoggerOrDefault(b.logger).WithFields(log.Fields{
+			"func": util.Trace(),
+		}).Info("Stubo recovered, closing circuit breaker")
+	}
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records failed call
+func (b *CircuitBreaker) Failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		util.LoggerOrDefault(b.logger).WithFields(log.Fields{
+			"func":     util.Trace(),
+			"failures": b.failures,
+			"coolDown": b.coolDown.String(),
+		}).Warn("Opening circuit breaker")
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release records call that failed because of the client (e.g. cancelled
+// call), failure count is not changed, but next probe call is allowed
+func (b *CircuitBreaker) Release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Status returns current circuit breaker state
+func (b *CircuitBreaker) Status() CircuitBreakerStatus {
+	if b == nil {
+		return CircuitBreakerStatus{State: "disabled"}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := CircuitBreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		FailureThreshold:    b.threshold,
+		CoolDownMs:          int64(b.coolDown / time.Millisecond),
+	}
+	if b.state != breakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
@@ -0,0 +1,69 @@
+package stubo
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := NewCircuitBreaker(CircuitBreakerConfig{})
+	expect(t, b == nil, true)
+	expect(t, b.Allow(), true)
+	b.Failure()
+	expect(t, b.Status().State, "disabled")
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 2, CoolDownMs: 20})
+	expect(t, b.Allow(), true)
+	b.Failure()
+	expect(t, b.Status().State, breakerClosed)
+	b.Failure()
+	expect(t, b.Status().State, breakerOpen)
+	expect(t, b.Allow(), false)
+
+	// after cool-down single probe is allowed
+	time.Sleep(30 * time.Millisecond)
+	expect(t, b.Allow(), true)
+	expect(t, b.Status().State, breakerHalfOpen)
+	expect(t, b.Allow(), false)
+
+	// failed probe opens circuit again
+	b.Failure()
+	expect(t, b.Status().State, breakerOpen)
+	expect(t, b.Allow(), false)
+
+	time.Sleep(30 * time.Millisecond)
+	expect(t, b.Allow(), true)
+	b.Success()
+	expect(t, b.Status().State, breakerClosed)
+	expect(t, b.Status().ConsecutiveFailures, 0)
+}
+
+func TestCircuitBreakerCancelledCalls(t *testing.T) {
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	})
+	defer server.Close()
+	c.Breaker = NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, CoolDownMs: 1000})
+
+	// clients that disconnect don't open the circuit
+	for i := 0; i < 3; i++ {
+		cancelled, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		var s params
+		s.path = "/stubo/api/v2/scenarios"
+		s.method = "GET"
+		_, err := c.makeRequest(cancelled, "GetScenarios", s)
+		refute(t, err, nil)
+	}
+	expect(t, c.Breaker.Status().State, breakerClosed)
+	expect(t, c.Breaker.Status().ConsecutiveFailures, 0)
+
+	// client body errors don't open it either
+	_, err := c.PutStubStream(ctx, StubRequest{Scenario: "first", Session: "first_1"}, &failingReader{data: []byte(`{`)})
+	refute(t, err, nil)
+	expect(t, c.Breaker.Status().State, breakerClosed)
+}
@@ -0,0 +1,287 @@
+// Package stubo is a client for Stubo REST API v2. It is used by LGC to
+// translate legacy API calls, but can also be used to call Stubo directly.
+package stubo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+)
+
+// Client calls Stubo API v2. Calls are retried according to retry policy,
+// go through circuit breaker and are balanced between Stubo nodes when
+// upstream pool is set
+type Client struct {
+	// HTTPClient - client used for calls to Stubo, http.DefaultClient is used
+	// if not set
+	HTTPClient *http.Client
+	// StuboURI - Stubo base URI (e.g. "http://localhost:8001")
+	StuboURI string
+	Retry    RetryPolicy
+	Breaker  *CircuitBreaker
+	// Timeout - total timeout for a single call to Stubo, not applied if zero
+	Timeout time.Duration
+	// BulkTimeout - total timeout for bulk calls, not applied if zero
+	BulkTimeout time.Duration
+	// Upstreams - Stubo nodes, StuboURI is used when pool is not set
+	Upstreams *UpstreamPool
+	// Logger - logger for calls to Stubo, standard logrus logger is used if
+	// not set
+	Logger *log.Logger
+	// Transformer - changes requests to Stubo and Stubo responses, not used
+	// if not set
+	Transformer Transformer
+}
+
+// httpClient returns client for calls to Stubo
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Transformer changes calls to Stubo. BeforeUpstream is called with every
+// request before it is sent (retried calls get new request), AfterUpstream is
+// called with Stubo response before its body is read. AfterUpstream can
+// replace response body, original body is closed by the client
+type Transformer interface {
+	BeforeUpstream(*http.Request)
+	AfterUpstream(*http.Response)
+}
+
+// Response is a raw Stubo response. Body can be passed through to the
+// client as is or decoded into one of API v2 response types with Decode
+type Response struct {
+	StatusCode int
+	Body       []byte
+	// op - client method that got the response
+	op string
+}
+
+// Decode unmarshals response body into v. Error with 502 status code is
+// returned when Stubo response is not valid JSON
+func (r *Response) Decode(v interface{}) error {
+	err := json.Unmarshal(r.Body, v)
+	if err != nil {
+		return &Error{Op: r.op, StatusCode: http.StatusBadGateway, Err: err}
+	}
+	return nil
+}
+
+type params struct {
+	path, body, method string
+	bodyBytes          []byte
+	headers            map[string]string
+	// bodyReader - request body that is streamed to Stubo instead of bodyBytes
+	bodyReader io.Reader
+	// affinity - "scenario:session" key, calls with the same key go to the
+	// same Stubo node
+	affinity string
+	// bulk calls get longer timeout
+	bulk bool
+}
+
+// logger returns client's logger
+func (c *Client) logger() *log.Logger {
+	return util.LoggerOrDefault(c.Logger)
+}
+
+// callContext returns context for a single call to Stubo with timeout applied
+func (c *Client) callContext(ctx context.Context, bulk bool) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := c.Timeout
+	if bulk {
+		timeout = c.BulkTimeout
+	}
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// makeRequest takes Params struct as paramateres and makes request to Stubo
+// then reads response body. Error is returned when Stubo responds with error
+// status code
+func (c *Client) makeRequest(ctx context.Context, op string, s params) (*Response, error) {
+	url := s.path
+	if s.bodyBytes == nil {
+		s.bodyBytes = []byte(s.body)
+	}
+
+	// logging get transformation
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"func":          method,
+		"url":           url,
+		"body":          s.body,
+		"headers":       s.headers,
+		"requestMethod": s.method,
+	}).Info("Transforming URL, preparing for request to Stubo")
+
+	ctx, cancel := c.callContext(ctx, s.bulk)
+	defer cancel()
+	resp, err := c.doWithRetry(ctx, true, s.affinity, func(base string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, s.method, base+url, bytes.NewBuffer(s.bodyBytes))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range s.headers {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		// logging read error
+		c.logger().WithFields(log.Fields{
+			"error": err.Error(),
+			"func":  method,
+			"url":   url,
+		}).Warn("Failed to get response from Stubo!")
+
+		return nil, &Error{Op: op, StatusCode: StatusCode(err), Err: err}
+	}
+	c.afterUpstream(resp)
+	defer resp.Body.Close()
+	// reading body
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		// logging read error
+		c.logger().WithFields(log.Fields{
+			"error": err.Error(),
+			"func":  method,
+			"url":   url,
+		}).Warn("Failed to read response from Stubo!")
+
+		return nil, &Error{Op: op, StatusCode: StatusCode(err), Err: err}
+	}
+	if resp.StatusCode >= 400 {
+		return nil, responseError(op, resp.StatusCode, body)
+	}
+	return &Response{StatusCode: resp.StatusCode, Body: body, op: op}, nil
+}
+
+// streamRequest makes request to Stubo with body streamed from s.bodyReader
+// and returns response without reading its body, so it can be streamed to the
+// client. Response is returned for any Stubo status code, caller must close
+// response body. Streamed requests are not retried since their body can be
+// read only once.
+func (c *Client) streamRequest(ctx context.Context, op string, s params) (*http.Response, error) {
+	url := s.path
+
+	// logging get transformation
+	method := util.Trace()
+	c.logger().WithFields(log.Fields{
+		"func":          method,
+		"url":           url,
+		"headers":       s.headers,
+		"requestMethod": s.method,
+	}).Info("Transforming URL, streaming request to Stubo")
+
+	ctx, cancel := c.callContext(ctx, s.bulk)
+	resp, err := c.doWithRetry(ctx, false, s.affinity, func(base string) (*http.Request, error) {
+		var body io.Reader
+		if s.bodyReader != nil {
+			body = requestBody{Reader: s.bodyReader}
+		}
+		req, err := http.NewRequestWithContext(ctx, s.method, base+url, body)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range s.headers {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		cancel()
+		c.logger().WithFields(log.Fields{
+			"error": err.Error(),
+			"func":  method,
+			"url":   url,
+		}).Warn("Failed to get response from Stubo!")
+
+		return nil, &Error{Op: op, StatusCode: StatusCode(err), Err: err}
+	}
+	c.afterUpstream(resp)
+	// call context must live until response body is read
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// afterUpstream passes Stubo response to transformer. When transformer
+// replaces response body original body is closed together with new one
+func (c *Client) afterUpstream(resp *http.Response) {
+	if c.Transformer == nil {
+		return
+	}
+	body := resp.Body
+	c.Transformer.AfterUpstream(resp)
+	if resp.Body != body {
+		resp.Body = &closeOriginal{ReadCloser: resp.Body, original: body}
+	}
+}
+
+// closeOriginal closes original response body after body set by transformer
+type closeOriginal struct {
+	io.ReadCloser
+	original io.ReadCloser
+}
+
+func (b *closeOriginal) Close() error {
+	err := b.ReadCloser.Close()
+	b.original.Close()
+	return err
+}
+
+// requestBody tags read errors of request body that is streamed to Stubo, so
+// they are not taken for Stubo failures
+type requestBody struct {
+	io.Reader
+}
+
+func (b requestBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = &bodyReadError{err: err}
+	}
+	return n, err
+}
+
+// bodyReadError - request body could not be read, e.g. client aborted upload
+// or body is too large
+type bodyReadError struct {
+	err error
+}
+
+func (e *bodyReadError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns cause of the failure
+func (e *bodyReadError) Unwrap() error {
+	return e.err
+}
+
+// cancelOnClose cancels call context when response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,56 @@
+package stubo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMakeRequestTimeout(t *testing.T) {
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	defer server.Close()
+	c.Timeout = 20 * time.Millisecond
+
+	var s params
+	s.path = "/stubo/api/v2/scenarios"
+	s.method = "GET"
+	_, err := c.makeRequest(ctx, "GetScenarios", s)
+	refute(t, err, nil)
+	expect(t, StatusCode(err), http.StatusGatewayTimeout)
+
+	// bulk calls use their own timeout
+	c.BulkTimeout = time.Second
+	s.bulk = true
+	response, err := c.makeRequest(ctx, "GetScenarios", s)
+	expect(t, err, nil)
+	expect(t, response.StatusCode, http.StatusOK)
+}
+
+func TestMakeRequestCancelled(t *testing.T) {
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.GetScenarios(ctx)
+	refute(t, err, nil)
+}
+
+func TestClientWithoutHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version": "0.7", "data": []}`))
+	}))
+	defer server.Close()
+
+	c := &Client{StuboURI: server.URL}
+	response, err := c.GetScenarios(ctx)
+	expect(t, err, nil)
+	expect(t, response.StatusCode, http.StatusOK)
+}
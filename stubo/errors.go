@@ -0,0 +1,77 @@
+package stubo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is returned by Client methods when call to Stubo fails or Stubo
+// responds with error status code
+type Error struct {
+	// Op - client method that failed, e.g. "PutStub"
+	Op string
+	// StatusCode - Stubo response status code. When Stubo was not reached it is
+	// status code that describes the failure (503 when circuit breaker is
+	// open, 504 on timeout, 400 for invalid request, etc.)
+	StatusCode int
+	// Body - Stubo response body, nil when Stubo was not reached
+	Body []byte
+	// Envelope - decoded Stubo error response, nil when Stubo was not reached
+	// or response body is not an API v2 error envelope
+	Envelope *ErrorResponse
+	// Err - cause of the failure, nil when Stubo responded with error
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return "stubo." + e.Op + ": " + e.Err.Error()
+	}
+	if e.Envelope != nil {
+		return fmt.Sprintf("stubo.%s: Stubo responded with status code %d: %s", e.Op, e.StatusCode, e.Envelope.Error.Message)
+	}
+	return fmt.Sprintf("stubo.%s: Stubo responded with status code %d", e.Op, e.StatusCode)
+}
+
+// Unwrap returns cause of the failure
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// responseError returns error for Stubo error response, API v2 error envelope
+// is decoded if response body contains one
+func responseError(op string, statusCode int, body []byte) error {
+	e := &Error{Op: op, StatusCode: statusCode, Body: body}
+	var envelope ErrorResponse
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error.Message != "" {
+		e.Envelope = &envelope
+	}
+	return e
+}
+
+// invalid returns error for request that can't be sent to Stubo
+func invalid(op, message string) error {
+	return &Error{Op: op, StatusCode: http.StatusBadRequest, Err: errors.New(message)}
+}
+
+// StatusCode returns HTTP status code that describes given error
+func StatusCode(err error) int {
+	var stuboErr *Error
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &stuboErr):
+		return stuboErr.StatusCode
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrNoHealthyUpstream):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,128 @@
+package stubo
+
+import "encoding/json"
+
+// StubRequest describes stub to put into scenario session or request that
+// is matched against session stubs
+type StubRequest struct {
+	Scenario string
+	Session  string
+	// Args - URL query that is passed to Stubo, e.g. "arg1=1&arg2=2"
+	Args string
+	// Headers - additional headers such as ext_module, delay_policy or stateful
+	Headers map[string]string
+	// Body - stub or request body, streaming methods take body separately
+	Body []byte
+}
+
+// SessionRequest describes session to begin or end
+type SessionRequest struct {
+	Scenario string
+	Session  string
+	// Mode - "record" or "playback", only used when beginning session
+	Mode string
+}
+
+// DeleteStubsRequest describes scenario stubs to delete
+type DeleteStubsRequest struct {
+	Scenario string
+	// Force - "true" deletes stubs even if scenario has sessions in playback
+	Force string
+	// TargetHost - host that owns scenario, defaults to Stubo host
+	TargetHost string
+}
+
+// DelayPolicyRequest describes delay policy to create or update
+type DelayPolicyRequest struct {
+	Name string `json:"name,omitempty"`
+	// DelayType - "fixed" or "normalvariate"
+	DelayType string `json:"delay_type,omitempty"`
+	// Milliseconds - delay for fixed delay policy
+	Milliseconds string `json:"milliseconds,omitempty"`
+	// Mean and Stddev - delay distribution for normalvariate delay policy
+	Mean   string `json:"mean,omitempty"`
+	Stddev string `json:"stddev,omitempty"`
+}
+
+// DelayPolicy structure for gettting delay policy references
+type DelayPolicy struct {
+	Name string `json:"name"`
+	Ref  string `json:"delayPolicyRef"`
+}
+
+// DelayPolicyResponse structure for unmarshaling JSON structures from API v2
+type DelayPolicyResponse struct {
+	Data    []DelayPolicy `json:"data"`
+	Version string        `json:"version"`
+}
+
+// ScenarioSummary structure for scenario entries in API v2 scenario list
+type ScenarioSummary struct {
+	Name string `json:"name"`
+	Ref  string `json:"scenarioRef"`
+}
+
+// ScenariosResponse structure for unmarshaling scenario list from API v2
+type ScenariosResponse struct {
+	Data    []ScenarioSummary `json:"data"`
+	Version string            `json:"version"`
+}
+
+// ScenarioSession structure for session details in API v2 scenario details
+type ScenarioSession struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// ScenarioDetail structure for scenario details from API v2
+type ScenarioDetail struct {
+	Name     string            `json:"name"`
+	Ref      string            `json:"scenarioRef"`
+	Sessions []ScenarioSession `json:"sessions"`
+}
+
+// ScenariosDetailResponse structure for unmarshaling scenario details from API v2
+type ScenariosDetailResponse struct {
+	Data    []ScenarioDetail `json:"data"`
+	Version string           `json:"version"`
+}
+
+// StubDetail structure for stub entries in API v2 scenario stubs response
+type StubDetail struct {
+	Stub json.RawMessage `json:"stub"`
+}
+
+// ScenarioStubsResponse structure for unmarshaling scenario stubs from API v2
+type ScenarioStubsResponse struct {
+	Data    []StubDetail `json:"data"`
+	Version string       `json:"version"`
+}
+
+// SessionStatus structure for session status returned by API v2 when session
+// is started
+type SessionStatus struct {
+	// Status - session mode, "record" or "playback"
+	Status      string `json:"status"`
+	Session     string `json:"session"`
+	Scenario    string `json:"scenario"`
+	ScenarioRef string `json:"scenarioRef"`
+	Message     string `json:"message"`
+}
+
+// SessionStatusResponse structure for unmarshaling session status from API v2
+type SessionStatusResponse struct {
+	Data    SessionStatus `json:"data"`
+	Version string        `json:"version"`
+}
+
+// ErrorDetail structure for error code and message in API v2 error responses
+type ErrorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse structure for unmarshaling API v2 error envelope
+type ErrorResponse struct {
+	Error   ErrorDetail `json:"error"`
+	Version string      `json:"version"`
+}
@@ -0,0 +1,186 @@
+package stubo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+)
+
+// RetryPolicy describes how failed requests to Stubo are retried. Only
+// idempotent requests (GET, HEAD, OPTIONS, PUT, DELETE) are retried unless
+// RetryAllMethods is enabled
+type RetryPolicy struct {
+	// MaxAttempts - maximum number of attempts, including first one
+	MaxAttempts int
+	// BackoffMs - backoff before second attempt, doubled for every next attempt
+	BackoffMs int
+	// MaxBackoffMs - upper limit for backoff
+	MaxBackoffMs int
+	// RetryableStatusCodes - response codes that are retried (such as 502, 503, 504)
+	RetryableStatusCodes []int
+	// RetryAllMethods - enables retries for non idempotent methods (POST)
+	RetryAllMethods bool
+}
+
+// idempotentMethods can be safely retried
+var idempotentMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"PUT":     true,
+	"DELETE":  true,
+}
+
+// attempts returns maximum number of attempts for given request method
+func (p RetryPolicy) attempts(method string) int {
+	if p.MaxAttempts < 1 || (!idempotentMethods[method] && !p.RetryAllMethods) {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// retryableStatus checks whether request that got this status code should be retried
+func (p RetryPolicy) retryableStatus(code int) bool {
+	for _, c := range p.RetryableStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns exponential backoff with jitter for given attempt (starting
+// from 1). Returned duration is between half and full exponential backoff.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := time.Duration(p.BackoffMs) * time.Millisecond
+	max := time.Duration(p.MaxBackoffMs) * time.Millisecond
+	for i := 1; i < attempt && (max == 0 || backoff < max); i++ {
+		backoff *= 2
+	}
+	if max > 0 && backoff > max {
+		backoff = max
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// isBodyError checks whether call failed because request body could not be
+// read, such failures are caused by the client and not by Stubo
+func isBodyError(err error) bool {
+	var bodyErr *bodyReadError
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &bodyErr) || errors.As(err, &maxBytesErr)
+}
+
+// doWithRetry performs request created by newRequest function and retries it
+// on transport errors and retryable status codes according to client's retry
+// policy. Request is created for every attempt so its body can be sent again,
+// Stubo node base URI is picked for every attempt as well, requests with
+// affinity key (such as "scenario:session") stick to the same node.
+// Every attempt goes through client's circuit breaker. Retries stop when
+// given context is done. Requests with bodies that can't be sent again must
+// not be replayed.
+func (c *Client) doWithRetry(ctx context.Context, replayable bool, affinity string, newRequest func(base string) (*http.Request, error)) (*http.Response, error) {
+	method := util.Trace()
+	var resp *http.Response
+	var err error
+	for attempt := 1; ; attempt++ {
+		var upstream *Upstream
+		base := c.StuboURI
+		if c.Upstreams != nil {
+			upstream, err = c.Upstreams.PickFor(affinity)
+			if err != nil {
+				return nil, err
+			}
+			base = upstream.URI
+		}
+		var req *http.Request
+		req, err = newRequest(base)
+		if err != nil {
+			if upstream != nil {
+				c.Upstreams.Done(upstream, nil)
+			}
+			return nil, err
+		}
+		if c.Transformer != nil {
+			c.Transformer.BeforeUpstream(req)
+		}
+		maxAttempts := 1
+		if replayable {
+			maxAttempts = c.Retry.attempts(req.Method)
+		}
+		if !c.Breaker.Allow() {
+			if upstream != nil {
+				c.Upstreams.Done(upstream, nil)
+			}
+			return nil, ErrCircuitOpen
+		}
+		resp, err = c.httpClient().Do(req)
+		if upstream != nil {
+			if err != nil {
+				// cancelled calls and client body errors are not node failures
+				if ctx.Err() != nil || isBodyError(err) {
+					c.Upstreams.Done(upstream, nil)
+				} else {
+					c.Upstreams.Done(upstream, err)
+				}
+			} else {
+				// node is busy until response body is read
+				resp.Body = &upstreamBody{ReadCloser: resp.Body, pool: c.Upstreams, upstream: upstream}
+			}
+		}
+		switch {
+		case err != nil && (errors.Is(ctx.Err(), context.Canceled) || isBodyError(err)):
+			// calls cancelled by the client and client body errors say
+			// nothing about Stubo
+			c.Breaker.Release()
+		case err != nil || resp.StatusCode >= 500:
+			c.Breaker.Failure()
+		default:
+			c.Breaker.Success()
+		}
+		if err == nil && !c.Retry.retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt >= maxAttempts {
+			if attempt > 1 {
+				c.logger().WithFields(log.Fields{
+					"func":     method,
+					"url":      req.URL.String(),
+					"attempts": attempt,
+				}).Warn("Giving up on request to Stubo")
+			}
+			return resp, err
+		}
+
+		fields := log.Fields{
+			"func":     method,
+			"url":      req.URL.String(),
+			"attempt":  attempt,
+			"attempts": maxAttempts,
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		} else {
+			fields["status_code"] = resp.StatusCode
+			resp.Body.Close()
+		}
+		backoff := c.Retry.backoff(attempt)
+		fields["backoff"] = backoff.String()
+		c.logger().WithFields(fields).Warn("Request to Stubo failed, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package stubo
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyAttempts(t *testing.T) {
+	var p RetryPolicy
+	expect(t, p.attempts("GET"), 1)
+
+	p.MaxAttempts = 3
+	expect(t, p.attempts("GET"), 3)
+	expect(t, p.attempts("DELETE"), 3)
+	expect(t, p.attempts("POST"), 1)
+
+	p.RetryAllMethods = true
+	expect(t, p.attempts("POST"), 3)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BackoffMs: 100, MaxBackoffMs: 300}
+	for i := 0; i < 10; i++ {
+		first := p.backoff(1)
+		expect(t, first >= 50*time.Millisecond && first <= 100*time.Millisecond, true)
+		second := p.backoff(2)
+		expect(t, second >= 100*time.Millisecond && second <= 200*time.Millisecond, true)
+		// capped by MaxBackoffMs
+		tenth := p.backoff(10)
+		expect(t, tenth >= 150*time.Millisecond && tenth <= 300*time.Millisecond, true)
+	}
+}
+
+func TestMakeRequestRetry(t *testing.T) {
+	calls := 0
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(503)
+		}
+		fmt.Fprint(w, "ok")
+	})
+	defer server.Close()
+	c.Retry = RetryPolicy{MaxAttempts: 3, RetryableStatusCodes: []int{503}}
+
+	var s params
+	s.path = "/stubo/api/v2/scenarios"
+	s.method = "PUT"
+	response, err := c.makeRequest(ctx, "PutDelayPolicy", s)
+	expect(t, err, nil)
+	expect(t, response.StatusCode, 200)
+	expect(t, string(response.Body), "ok")
+	expect(t, calls, 3)
+}
+
+func TestMakeRequestNoRetryPost(t *testing.T) {
+	calls := 0
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(503)
+	})
+	defer server.Close()
+	c.Retry = RetryPolicy{MaxAttempts: 3, RetryableStatusCodes: []int{503}}
+
+	var s params
+	s.path = "/stubo/api/v2/scenarios/objects/first/action"
+	s.method = "POST"
+	_, err := c.makeRequest(ctx, "BeginSession", s)
+	refute(t, err, nil)
+	expect(t, StatusCode(err), 503)
+	expect(t, calls, 1)
+}
+
+func TestGetResponseBodyRetryTransportError(t *testing.T) {
+	server, c := testTools(200, "ok")
+	// closed server results in transport errors
+	server.Close()
+	c.Retry = RetryPolicy{MaxAttempts: 2}
+
+	_, err := c.GetScenarios(ctx)
+	refute(t, err, nil)
+}
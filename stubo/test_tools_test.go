@@ -1,4 +1,4 @@
-package main
+package stubo
 
 import (
 	"fmt"
@@ -22,12 +22,18 @@ func refute(t *testing.T, a interface{}, b interface{}) {
 }
 
 func testTools(code int, body string) (*httptest.Server, *Client) {
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(code)
 		w.Header().Set("Content-Type", "application/json")
 		fmt.Fprintln(w, body)
-	}))
+	})
+}
+
+// testToolsHandler creates test server with custom handler, useful when
+// different Stubo responses are needed during a single test
+func testToolsHandler(handler http.HandlerFunc) (*httptest.Server, *Client) {
+
+	server := httptest.NewServer(handler)
 
 	tr := &http.Transport{
 		Proxy: func(req *http.Request) (*url.URL, error) {
@@ -36,7 +42,6 @@ func testTools(code int, body string) (*httptest.Server, *Client) {
 	}
 	httpClient := &http.Client{Transport: tr}
 
-	client := &Client{httpClient}
-	StuboURI = "http://localhost:3000"
+	client := &Client{HTTPClient: httpClient, StuboURI: "http://localhost:3000"}
 	return server, client
 }
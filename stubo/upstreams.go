@@ -0,0 +1,308 @@
+package stubo
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+)
+
+// ErrNoHealthyUpstream is returned when all configured Stubo nodes are ejected
+var ErrNoHealthyUpstream = errors.New("no healthy Stubo nodes available")
+
+// load balancing strategies
+const (
+	roundRobin       = "round_robin"
+	leastConnections = "least_connections"
+)
+
+// virtualNodes - number of points every node gets on consistent hashing ring
+const virtualNodes = 100
+
+// default health check settings
+const (
+	defaultHealthCheckPath     = "/stubo/api/v2/scenarios"
+	defaultHealthCheckInterval = 10 * time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+	defaultEjectDuration       = 30 * time.Second
+)
+
+// UpstreamsConfig - multiple Stubo nodes sharing the same database. When URIs
+// are not set, single Stubo instance from StuboHost/StuboPort is used
+type UpstreamsConfig struct {
+	// URIs - Stubo nodes, e.g. "http://stubo-1:8001"
+	URIs []string
+	// Strategy - "round_robin" (default) or "least_connections"
+	Strategy string
+	// HealthCheckPath - path that is called during active health checks
+	HealthCheckPath string
+	// HealthCheckIntervalMs - time between active health checks
+	HealthCheckIntervalMs int
+	// HealthCheckTimeoutMs - time node has to answer health check
+	HealthCheckTimeoutMs int
+	// EjectMs - time node is not used after transport error
+	EjectMs int
+}
+
+// Upstream is a single Stubo node
+type Upstream struct {
+	URI string
+
+	active       atomic.Int64
+	mu           sync.Mutex
+	healthy      bool
+	ejectedUntil time.Time
+}
+
+// available checks whether node can receive requests
+func (u *Upstream) available(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.healthy && !now.Before(u.ejectedUntil)
+}
+
+// UpstreamStatus describes Stubo node state
+type UpstreamStatus struct {
+	URI               string `json:"uri"`
+	Healthy           bool   `json:"healthy"`
+	Ejected           bool   `json:"ejected"`
+	ActiveConnections int64  `json:"active_connections"`
+}
+
+// ringPoint is a virtual node on consistent hashing ring
+type ringPoint struct {
+	hash     uint32
+	upstream *Upstream
+}
+
+// UpstreamPool picks Stubo node for every request. Nodes that fail active
+// health checks or get transport errors are ejected from the pool. Requests
+// with affinity key (such as "scenario:session") are routed with consistent
+// hashing, so the same session always hits the same node.
+type UpstreamPool struct {
+	upstreams []*Upstream
+	strategy  string
+	ejectFor  time.Duration
+	next      atomic.Uint64
+	ring      []ringPoint
+	logger    *log.Logger
+}
+
+// SetLogger sets logger for Stubo node failures and health changes
+func (p *UpstreamPool) SetLogger(logger *log.Logger) {
+	p.logger = logger
+}
+
+// NewUpstreamPool returns pool of Stubo nodes, all nodes are considered
+// healthy until first health check
+func NewUpstreamPool(cfg UpstreamsConfig) *UpstreamPool {
+	pool := &UpstreamPool{
+		strategy: cfg.Strategy,
+		ejectFor: util.Duration(cfg.EjectMs, defaultEjectDuration),
+	}
+	if pool.strategy == "" {
+		pool.strategy = roundRobin
+	}
+	for _, uri := range cfg.URIs {
+		u := &Upstream{URI: uri, healthy: true}
+		pool.upstreams = append(pool.upstreams, u)
+		for i := 0; i < virtualNodes; i++ {
+			pool.ring = append(pool.ring, ringPoint{hash: hashKey(uri + "#" + strconv.Itoa(i)), upstream: u})
+		}
+	}
+	sort.Slice(pool.ring, func(i, j int) bool {
+		return pool.ring[i].hash < pool.ring[j].hash
+	})
+	return pool
+}
+
+// hashKey returns position on consistent hashing ring
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// PickFor returns node for given affinity key. Ring contains all nodes, so
+// when node is not available only its keys are moved to the next nodes on
+// the ring. Requests without affinity key are balanced as usual.
+func (p *UpstreamPool) PickFor(key string) (*Upstream, error) {
+	if key == "" || len(p.ring) == 0 {
+		return p.Pick()
+	}
+	now := time.Now()
+	h := hashKey(key)
+	start := sort.Search(len(p.ring), func(i int) bool {
+		return p.ring[i].hash >= h
+	})
+	for i := 0; i < len(p.ring); i++ {
+		u := p.ring[(start+i)%len(p.ring)].upstream
+		if u.available(now) {
+			u.active.Add(1)
+			return u, nil
+		}
+	}
+	return nil, ErrNoHealthyUpstream
+}
+
+// Pick returns node that should receive next request
+func (p *UpstreamPool) Pick() (*Upstream, error) {
+	now := time.Now()
+	var candidates []*Upstream
+	for _, u := range p.upstreams {
+		if u.available(now) {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoHealthyUpstream
+	}
+
+	var picked *Upstream
+	if p.strategy == leastConnections {
+		for _, u := range candidates {
+			if picked == nil || u.active.Load() < picked.active.Load() {
+				picked = u
+			}
+		}
+	} else {
+		n := p.next.Add(1) - 1
+		picked = candidates[n%uint64(len(candidates))]
+	}
+	picked.active.Add(1)
+	return picked, nil
+}
+
+// Done must be called when request to node is finished, node is ejected
+// for a while if request failed with transport error
+func (p *UpstreamPool) Done(u *Upstream, err error) {
+	u.active.Add(-1)
+	if err == nil {
+		return
+	}
+	u.mu.Lock()
+	u.ejectedUntil = time.Now().Add(p.ejectFor)
+	u.mu.Unlock()
+
+	util.LoggerOrDefault(p.logger).WithFields(log.Fields{
+		"func":     util.Trace(),
+		"upstream": u.URI,
+		"error":    err.Error(),
+		"ejectFor": p.ejectFor.String(),
+	}).Warn("Stubo node failed, ejecting it")
+}
+
+// upstreamBody releases Stubo node when response body is closed
+type upstreamBody struct {
+	io.ReadCloser
+	pool     *UpstreamPool
+	upstream *Upstream
+	once     sync.Once
+}
+
+func (b *upstreamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.pool.Done(b.upstream, nil)
+	})
+	return err
+}
+
+// checkHealth calls all nodes at once and marks them as healthy or unhealthy.
+// Node that doesn't answer within timeout is unhealthy, so hanging node
+// doesn't hold up checks of other nodes
+func (p *UpstreamPool) checkHealth(client *http.Client, path string, timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func(u *Upstream) {
+			defer wg.Done()
+			p.probe(client, u, path, timeout)
+		}(u)
+	}
+	wg.Wait()
+}
+
+// probe checks health of a single node
+func (p *UpstreamPool) probe(client *http.Client, u *Upstream, path string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	healthy := false
+	req, err := http.NewRequestWithContext(ctx, "GET", u.URI+path, nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			healthy = resp.StatusCode < 500
+		}
+	}
+
+	u.mu.Lock()
+	changed := u.healthy != healthy
+	u.healthy = healthy
+	if healthy {
+		// recovered node can be used again straight away
+		u.ejectedUntil = time.Time{}
+	}
+	u.mu.Unlock()
+
+	if changed {
+		fields := log.Fields{
+			"func":     util.Trace(),
+			"upstream": u.URI,
+			"healthy":  healthy,
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		}
+		util.LoggerOrDefault(p.logger).WithFields(fields).Warn("Stubo node health changed")
+	}
+}
+
+// StartHealthChecks checks nodes periodically until stop channel is closed
+func (p *UpstreamPool) StartHealthChecks(client *http.Client, cfg UpstreamsConfig, stop <-chan struct{}) {
+	path := cfg.HealthCheckPath
+	if path == "" {
+		path = defaultHealthCheckPath
+	}
+	timeout := util.Duration(cfg.HealthCheckTimeoutMs, defaultHealthCheckTimeout)
+	ticker := time.NewTicker(util.Duration(cfg.HealthCheckIntervalMs, defaultHealthCheckInterval))
+	go func() {
+		defer ticker.Stop()
+		for {
+			p.checkHealth(client, path, timeout)
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Status returns state of all nodes
+func (p *UpstreamPool) Status() []UpstreamStatus {
+	now := time.Now()
+	var statuses []UpstreamStatus
+	for _, u := range p.upstreams {
+		u.mu.Lock()
+		statuses = append(statuses, UpstreamStatus{
+			URI:               u.URI,
+			Healthy:           u.healthy,
+			Ejected:           now.Before(u.ejectedUntil),
+			ActiveConnections: u.active.Load(),
+		})
+		u.mu.Unlock()
+	}
+	return statuses
+}
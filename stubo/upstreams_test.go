@@ -0,0 +1,210 @@
+package stubo
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpstreamPoolRoundRobin(t *testing.T) {
+	pool := NewUpstreamPool(UpstreamsConfig{URIs: []string{"http://stubo-1", "http://stubo-2"}})
+	var picked []string
+	for i := 0; i < 4; i++ {
+		u, err := pool.Pick()
+		expect(t, err, nil)
+		picked = append(picked, u.URI)
+		pool.Done(u, nil)
+	}
+	expect(t, fmt.Sprint(picked), "[http://stubo-1 http://stubo-2 http://stubo-1 http://stubo-2]")
+}
+
+func TestUpstreamPoolLeastConnections(t *testing.T) {
+	pool := NewUpstreamPool(UpstreamsConfig{
+		URIs:     []string{"http://stubo-1", "http://stubo-2"},
+		Strategy: leastConnections,
+	})
+	first, _ := pool.Pick()
+	second, _ := pool.Pick()
+	refute(t, first.URI, second.URI)
+
+	// first node is released, so it has less connections
+	pool.Done(first, nil)
+	third, _ := pool.Pick()
+	expect(t, third.URI, first.URI)
+}
+
+func TestUpstreamPoolPassiveEjection(t *testing.T) {
+	pool := NewUpstreamPool(UpstreamsConfig{URIs: []string{"http://stubo-1", "http://stubo-2"}})
+	u, _ := pool.Pick()
+	pool.Done(u, errors.New("connection refused"))
+
+	for i := 0; i < 3; i++ {
+		next, err := pool.Pick()
+		expect(t, err, nil)
+		refute(t, next.URI, u.URI)
+		pool.Done(next, nil)
+	}
+
+	next, _ := pool.Pick()
+	pool.Done(next, errors.New("connection refused"))
+	_, err := pool.Pick()
+	expect(t, err, ErrNoHealthyUpstream)
+}
+
+func TestUpstreamPoolHealthCheck(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer unhealthy.Close()
+
+	pool := NewUpstreamPool(UpstreamsConfig{URIs: []string{healthy.URL, unhealthy.URL}})
+	pool.checkHealth(&http.Client{}, defaultHealthCheckPath, time.Second)
+
+	statuses := pool.Status()
+	expect(t, statuses[0].Healthy, true)
+	expect(t, statuses[1].Healthy, false)
+	for i := 0; i < 3; i++ {
+		u, err := pool.Pick()
+		expect(t, err, nil)
+		expect(t, u.URI, healthy.URL)
+		pool.Done(u, nil)
+	}
+}
+
+func TestUpstreamPoolHealthCheckTimeout(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+
+	// hanging node is probed together with others and gets unhealthy on timeout
+	pool := NewUpstreamPool(UpstreamsConfig{URIs: []string{hanging.URL, healthy.URL, hanging.URL}})
+	started := time.Now()
+	pool.checkHealth(&http.Client{}, defaultHealthCheckPath, 50*time.Millisecond)
+	expect(t, time.Since(started) < time.Second, true)
+
+	statuses := pool.Status()
+	expect(t, statuses[0].Healthy, false)
+	expect(t, statuses[1].Healthy, true)
+	expect(t, statuses[2].Healthy, false)
+}
+
+func TestMakeRequestUpstreams(t *testing.T) {
+	var hosts []string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		fmt.Fprint(w, "ok")
+	})
+	defer server.Close()
+	c.Upstreams = NewUpstreamPool(UpstreamsConfig{URIs: []string{"http://stubo-1", "http://stubo-2"}})
+
+	var s params
+	s.path = "/stubo/api/v2/scenarios"
+	s.method = "GET"
+	for i := 0; i < 2; i++ {
+		response, err := c.makeRequest(ctx, "GetScenarios", s)
+		expect(t, err, nil)
+		expect(t, response.StatusCode, 200)
+	}
+	expect(t, fmt.Sprint(hosts), "[stubo-1 stubo-2]")
+	// connections are released after response body is read
+	for _, status := range c.Upstreams.Status() {
+		expect(t, status.ActiveConnections, int64(0))
+	}
+}
+
+func TestUpstreamPoolAffinity(t *testing.T) {
+	uris := []string{"http://stubo-1", "http://stubo-2", "http://stubo-3"}
+	pool := NewUpstreamPool(UpstreamsConfig{URIs: uris})
+
+	// same session always goes to the same node
+	assigned := make(map[string]*Upstream)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("scenario:session_%d", i)
+		u, err := pool.PickFor(key)
+		expect(t, err, nil)
+		pool.Done(u, nil)
+		assigned[key] = u
+		again, _ := pool.PickFor(key)
+		pool.Done(again, nil)
+		expect(t, again, u)
+	}
+
+	// node goes down, only its sessions are moved
+	down := assigned["scenario:session_0"]
+	down.mu.Lock()
+	down.healthy = false
+	down.mu.Unlock()
+	for key, u := range assigned {
+		now, err := pool.PickFor(key)
+		expect(t, err, nil)
+		pool.Done(now, nil)
+		if u == down {
+			refute(t, now, down)
+		} else {
+			expect(t, now, u)
+		}
+	}
+}
+
+// failingReader returns error after its data is read, like aborted upload
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("client aborted upload")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestStreamRequestBodyErrorKeepsUpstream(t *testing.T) {
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	})
+	defer server.Close()
+	c.Upstreams = NewUpstreamPool(UpstreamsConfig{URIs: []string{server.URL}})
+
+	req := StubRequest{Scenario: "first", Session: "first_1"}
+	_, err := c.PutStubStream(ctx, req, &failingReader{data: []byte(`{"request": `)})
+	refute(t, err, nil)
+
+	// node is still healthy
+	u, err := c.Upstreams.Pick()
+	expect(t, err, nil)
+	c.Upstreams.Done(u, nil)
+}
+
+func TestSessionAffinityHostPrefix(t *testing.T) {
+	var hosts []string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		fmt.Fprint(w, `{"version": "0.6.6", "data": {}}`)
+	})
+	defer server.Close()
+	c.Upstreams = NewUpstreamPool(UpstreamsConfig{URIs: []string{"http://stubo-1", "http://stubo-2"}})
+
+	// session is begun with plain scenario name and ended with host prefixed
+	// name found in scenario details, both calls go to the same node
+	for i := 0; i < 20; i++ {
+		hosts = nil
+		session := fmt.Sprintf("session_%d", i)
+		_, err := c.BeginSession(ctx, SessionRequest{Scenario: "first", Session: session, Mode: "record"})
+		expect(t, err, nil)
+		_, err = c.EndSession(ctx, SessionRequest{Scenario: "localhost:first", Session: session})
+		expect(t, err, nil)
+		expect(t, len(hosts), 2)
+		expect(t, hosts[0], hosts[1])
+	}
+}
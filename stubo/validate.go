@@ -0,0 +1,46 @@
+package stubo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"unicode"
+)
+
+// maxNameLength - maximum length of scenario, session and delay policy names
+const maxNameLength = 255
+
+// validateName checks that scenario, session or delay policy name can be
+// used in Stubo URL path or request body. Kind is used in error message, e.g.
+// "scenario name"
+func validateName(op, kind, name string) error {
+	switch {
+	case name == "":
+		return invalid(op, kind+" not supplied")
+	case len(name) > maxNameLength:
+		return invalid(op, fmt.Sprintf("%s is longer than %d characters", kind, maxNameLength))
+	case name == "." || name == "..":
+		return invalid(op, fmt.Sprintf("%s '%s' is not allowed", kind, name))
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return invalid(op, fmt.Sprintf("%s %q contains control characters", kind, name))
+		}
+	}
+	return nil
+}
+
+// ValidateName checks that name can be used in Stubo URL path, names such as
+// ".." would change the path. Kind is used in error message, e.g. "scenario name"
+func ValidateName(kind, name string) error {
+	return validateName("ValidateName", kind, name)
+}
+
+// jsonBody encodes request body for Stubo
+func jsonBody(op string, v interface{}) (string, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return "", &Error{Op: op, StatusCode: http.StatusBadRequest, Err: err}
+	}
+	return string(body), nil
+}
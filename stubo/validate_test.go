@@ -0,0 +1,63 @@
+package stubo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	expect(t, validateName("Test", "scenario name", "localhost:first"), nil)
+	expect(t, validateName("Test", "scenario name", `first/"second"?#`), nil)
+
+	err := validateName("Test", "scenario name", "")
+	expect(t, StatusCode(err), 400)
+	expect(t, strings.Contains(err.Error(), "scenario name not supplied"), true)
+
+	err = validateName("Test", "session name", "first\n")
+	expect(t, StatusCode(err), 400)
+	expect(t, strings.Contains(err.Error(), "contains control characters"), true)
+
+	err = validateName("Test", "scenario name", "..")
+	expect(t, StatusCode(err), 400)
+
+	err = validateName("Test", "scenario name", strings.Repeat("a", maxNameLength+1))
+	expect(t, StatusCode(err), 400)
+	expect(t, strings.Contains(err.Error(), "longer than 255 characters"), true)
+}
+
+// TestBeginSessionEscaping - scenario name with "/", "?" and "#" stays in one
+// path segment and session name with quotes produces valid JSON body
+func TestBeginSessionEscaping(t *testing.T) {
+	var path string
+	var body map[string]interface{}
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		data, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		w.Write([]byte(`{"version": "1.2.3", "data": {}}`))
+	})
+	defer server.Close()
+
+	_, err := c.BeginSession(ctx, SessionRequest{Scenario: "host:a/b?c#d", Session: `say "hi"`, Mode: "record"})
+	expect(t, err, nil)
+	expect(t, path, "/stubo/api/v2/scenarios/objects/host:a%2Fb%3Fc%23d/action")
+	expect(t, body["session"], `say "hi"`)
+	expect(t, body["mode"], "record")
+	_, ok := body["begin"]
+	expect(t, ok, true)
+}
+
+func TestCreateScenarioInvalidName(t *testing.T) {
+	called := false
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	defer server.Close()
+
+	_, err := c.CreateScenario(ctx, "first\x00")
+	expect(t, StatusCode(err), 400)
+	expect(t, called, false)
+}
@@ -0,0 +1,138 @@
+package lgc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+	"github.com/rusenask/lgc/stubo"
+)
+
+// defaultTenantHeader - request header that carries tenant name
+const defaultTenantHeader = "X-Stubo-Tenant"
+
+// tenantPrefix - URL prefix that carries tenant name, e.g.
+// /t/team-a/stubo/api/get/response
+const tenantPrefix = "/t/"
+
+// TenantsConfig - routing of different teams to their own Stubo clusters.
+// Tenant is resolved from URL prefix (/t/{tenant}/stubo/api/...), tenant
+// header or host header, in this order. Requests without tenant go to default
+// Stubo (StuboHost/StuboPort or Upstreams)
+type TenantsConfig struct {
+	// Header - request header with tenant name, defaults to "X-Stubo-Tenant"
+	Header string
+	// Hosts - maps LGC host names (without port) to tenant names
+	Hosts map[string]string
+	// Upstreams - maps tenant names to their Stubo URIs
+	Upstreams map[string]string
+}
+
+// tenantUpstream - Stubo that serves tenant's requests
+type tenantUpstream struct {
+	Tenant  string
+	URI     string
+	Breaker *stubo.CircuitBreaker
+}
+
+type tenantContextKey struct{}
+
+// withTenantUpstream returns context that carries tenant's Stubo
+func withTenantUpstream(ctx context.Context, t *tenantUpstream) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, t)
+}
+
+// tenantUpstreamFromContext returns tenant's Stubo, if request belongs to a tenant
+func tenantUpstreamFromContext(ctx context.Context) (*tenantUpstream, bool) {
+	t, ok := ctx.Value(tenantContextKey{}).(*tenantUpstream)
+	return t, ok
+}
+
+// requestTenant returns name of tenant that request belongs to, empty string
+// is returned for requests without tenant
+func requestTenant(r *http.Request) string {
+	if t, ok := tenantUpstreamFromContext(r.Context()); ok {
+		return t.Tenant
+	}
+	return ""
+}
+
+// resolveTenant returns tenant name for given request and request path
+// without tenant prefix
+func (cfg TenantsConfig) resolveTenant(r *http.Request) (tenant, path string) {
+	path = r.URL.Path
+	if strings.HasPrefix(path, tenantPrefix) {
+		rest := strings.TrimPrefix(path, tenantPrefix)
+		if i := strings.Index(rest, "/"); i > 0 {
+			return rest[:i], rest[i:]
+		}
+	}
+
+	header := cfg.Header
+	if header == "" {
+		header = defaultTenantHeader
+	}
+	if tenant = r.Header.Get(header); tenant != "" {
+		return tenant, path
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return cfg.Hosts[host], path
+}
+
+// newTenantUpstreams returns Stubo of every configured tenant. Every tenant
+// gets its own circuit breaker, so one team's failing Stubo does not block
+// others
+func newTenantUpstreams(cfg TenantsConfig, breaker stubo.CircuitBreakerConfig, logger *log.Logger) map[string]*tenantUpstream {
+	upstreams := make(map[string]*tenantUpstream)
+	for tenant, uri := range cfg.Upstreams {
+		upstreams[tenant] = &tenantUpstream{
+			Tenant:  tenant,
+			URI:     uri,
+			Breaker: stubo.NewCircuitBreaker(breaker),
+		}
+		upstreams[tenant].Breaker.SetLogger(logger)
+	}
+	return upstreams
+}
+
+// newTenantRouter resolves tenant's Stubo before request reaches handlers.
+// Given handler is returned unchanged when no tenants are configured
+func newTenantRouter(cfg TenantsConfig, upstreams map[string]*tenantUpstream, logger *log.Logger, next http.Handler) http.Handler {
+	if len(upstreams) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, path := cfg.resolveTenant(r)
+		if tenant == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		upstream, ok := upstreams[tenant]
+		if !ok {
+			logger.WithFields(log.Fields{
+				"url_path": r.URL.Path,
+				"tenant":   tenant,
+				"func":     util.Trace(),
+			}).Warn("Unknown tenant")
+			writeError(w, notFound("Unknown tenant: "+tenant))
+			return
+		}
+
+		req := r.WithContext(withTenantUpstream(r.Context(), upstream))
+		if path != r.URL.Path {
+			u := *r.URL
+			u.Path = path
+			u.RawPath = ""
+			req.URL = &u
+		}
+		next.ServeHTTP(w, req)
+	})
+}
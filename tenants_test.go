@@ -0,0 +1,123 @@
+package lgc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/stubo"
+)
+
+func TestResolveTenant(t *testing.T) {
+	cfg := TenantsConfig{
+		Hosts: map[string]string{"team-b.lgc.local": "team-b"},
+	}
+
+	req, _ := http.NewRequest("GET", "/t/team-a/stubo/api/get/stublist", nil)
+	tenant, path := cfg.resolveTenant(req)
+	expect(t, tenant, "team-a")
+	expect(t, path, "/stubo/api/get/stublist")
+
+	req, _ = http.NewRequest("GET", "/stubo/api/get/stublist", nil)
+	req.Header.Set("X-Stubo-Tenant", "team-c")
+	tenant, path = cfg.resolveTenant(req)
+	expect(t, tenant, "team-c")
+	expect(t, path, "/stubo/api/get/stublist")
+
+	req, _ = http.NewRequest("GET", "http://team-b.lgc.local:3000/stubo/api/get/stublist", nil)
+	tenant, _ = cfg.resolveTenant(req)
+	expect(t, tenant, "team-b")
+
+	req, _ = http.NewRequest("GET", "/stubo/api/get/stublist", nil)
+	tenant, _ = cfg.resolveTenant(req)
+	expect(t, tenant, "")
+}
+
+func TestTenantRouter(t *testing.T) {
+	var host string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		w.Write([]byte(`{"version":"1.2.3","data": []}`))
+	})
+	defer server.Close()
+
+	cfg := TenantsConfig{
+		Upstreams: map[string]string{"team-a": "http://stubo-team-a:8001"},
+	}
+	m := newTenantRouter(cfg, newTenantUpstreams(cfg, stubo.CircuitBreakerConfig{}, log.StandardLogger()), log.StandardLogger(), setup(*c))
+
+	// tenant from URL prefix
+	req, err := http.NewRequest("GET", "/t/team-a/stubo/api/get/stublist?scenario=scenario1", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, host, "stubo-team-a:8001")
+
+	// no tenant - default Stubo
+	req, err = http.NewRequest("GET", "/stubo/api/get/stublist?scenario=scenario1", nil)
+	expect(t, err, nil)
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, host, "localhost:3000")
+
+	// unknown tenant
+	req, err = http.NewRequest("GET", "/stubo/api/get/stublist?scenario=scenario1", nil)
+	expect(t, err, nil)
+	req.Header.Set("X-Stubo-Tenant", "team-x")
+	respRec = httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+	expect(t, respRec.Code, http.StatusNotFound)
+}
+
+func TestTenantCircuitBreakerStatus(t *testing.T) {
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(502)
+	})
+	defer server.Close()
+
+	proxy, err := NewProxy(Configuration{
+		StuboProtocol:  "http",
+		StuboHost:      "localhost",
+		StuboPort:      "3000",
+		HTTPClient:     c.HTTPClient,
+		Tenants:        TenantsConfig{Upstreams: map[string]string{"team-a": "http://stubo-team-a:8001"}},
+		CircuitBreaker: stubo.CircuitBreakerConfig{FailureThreshold: 1, CoolDownMs: 60000},
+	})
+	expect(t, err, nil)
+	defer proxy.Close()
+
+	// opening team-a breaker
+	req, err := http.NewRequest("GET", "/t/team-a/stubo/api/get/scenarios", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(respRec, req)
+	expect(t, respRec.Code, http.StatusBadGateway)
+
+	status := func(path string) (int, string) {
+		req, err := http.NewRequest("GET", path, nil)
+		expect(t, err, nil)
+		respRec := httptest.NewRecorder()
+		proxy.Handler().ServeHTTP(respRec, req)
+		return respRec.Code, respRec.Body.String()
+	}
+
+	code, body := status("/lgc/admin/circuit_breaker?tenant=team-a")
+	expect(t, code, http.StatusOK)
+	expect(t, strings.Contains(body, `"state":"open"`), true)
+
+	code, body = status("/t/team-a/lgc/admin/circuit_breaker")
+	expect(t, code, http.StatusOK)
+	expect(t, strings.Contains(body, `"state":"open"`), true)
+
+	// default Stubo breaker is not affected
+	code, body = status("/lgc/admin/circuit_breaker")
+	expect(t, code, http.StatusOK)
+	expect(t, strings.Contains(body, `"state":"closed"`), true)
+
+	code, _ = status("/lgc/admin/circuit_breaker?tenant=team-x")
+	expect(t, code, http.StatusNotFound)
+}
@@ -0,0 +1,49 @@
+package lgc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/rusenask/lgc/stubo"
+)
+
+func expect(t *testing.T, a interface{}, b interface{}) {
+	if a != b {
+		t.Errorf("Expected %v (type %v) - Got %v (type %v)", b, reflect.TypeOf(b), a, reflect.TypeOf(a))
+	}
+}
+
+func refute(t *testing.T, a interface{}, b interface{}) {
+	if a == b {
+		t.Errorf("Did not expect %v (type %v) - Got %v (type %v)", b, reflect.TypeOf(b), a, reflect.TypeOf(a))
+	}
+}
+
+func testTools(code int, body string) (*httptest.Server, *stubo.Client) {
+	return testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, body)
+	})
+}
+
+// testToolsHandler creates test server with custom handler, useful when
+// different Stubo responses are needed during a single test
+func testToolsHandler(handler http.HandlerFunc) (*httptest.Server, *stubo.Client) {
+
+	server := httptest.NewServer(handler)
+
+	tr := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return url.Parse(server.URL)
+		},
+	}
+	httpClient := &http.Client{Transport: tr}
+
+	client := &stubo.Client{HTTPClient: httpClient, StuboURI: "http://localhost:3000"}
+	return server, client
+}
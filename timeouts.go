@@ -0,0 +1,72 @@
+package lgc
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rusenask/lgc/internal/util"
+)
+
+// TimeoutsConfig - timeouts (in milliseconds) for calls to Stubo and for LGC
+// server itself. Default values are used for timeouts that are not set
+type TimeoutsConfig struct {
+	// ConnectMs - timeout for establishing connection to Stubo
+	ConnectMs int
+	// ResponseHeaderMs - timeout for waiting for Stubo response headers
+	ResponseHeaderMs int
+	// TotalMs - timeout for a single call to Stubo, including retries and
+	// reading response body
+	TotalMs int
+	// BulkMs - timeout for calls that work with many objects at once, such as
+	// getting or deleting all scenario stubs or deleting all delay policies
+	BulkMs int
+	// ServerReadMs - timeout for reading client's request
+	ServerReadMs int
+	// ServerWriteMs - timeout for writing response to client, should be longer
+	// than BulkMs
+	ServerWriteMs int
+	// ServerIdleMs - timeout for idle keep-alive connections
+	ServerIdleMs int
+}
+
+// default timeouts
+const (
+	defaultConnectTimeout        = 5 * time.Second
+	defaultResponseHeaderTimeout = 30 * time.Second
+	defaultTotalTimeout          = 60 * time.Second
+	defaultBulkTimeout           = 5 * time.Minute
+	defaultServerReadTimeout     = 60 * time.Second
+	defaultServerWriteTimeout    = 6 * time.Minute
+	defaultServerIdleTimeout     = 2 * time.Minute
+)
+
+// newHTTPClient returns HTTP client for calls to Stubo with connection and
+// response header timeouts. Total timeouts are applied per call by Client
+func newHTTPClient(cfg TimeoutsConfig) *http.Client {
+	connectTimeout := util.Duration(cfg.ConnectMs, defaultConnectTimeout)
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   connectTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   connectTimeout,
+			ResponseHeaderTimeout: util.Duration(cfg.ResponseHeaderMs, defaultResponseHeaderTimeout),
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConnsPerHost:   10,
+		},
+	}
+}
+
+// NewServer returns LGC server with read, write and idle timeouts
+func NewServer(addr string, handler http.Handler, cfg TimeoutsConfig) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  util.Duration(cfg.ServerReadMs, defaultServerReadTimeout),
+		WriteTimeout: util.Duration(cfg.ServerWriteMs, defaultServerWriteTimeout),
+		IdleTimeout:  util.Duration(cfg.ServerIdleMs, defaultServerIdleTimeout),
+	}
+}
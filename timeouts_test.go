@@ -0,0 +1,12 @@
+package lgc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewServerTimeouts(t *testing.T) {
+	server := NewServer(":3000", nil, TimeoutsConfig{ServerReadMs: 1500})
+	expect(t, server.ReadTimeout, 1500*time.Millisecond)
+	expect(t, server.WriteTimeout, defaultServerWriteTimeout)
+}
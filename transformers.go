@@ -0,0 +1,131 @@
+package lgc
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rusenask/lgc/stubo"
+)
+
+// Transformer changes calls to Stubo that are made for legacy route, e.g.
+// renames headers, injects default delay policy or rewrites hostnames in
+// recorded responses. BeforeUpstream is called with every request to Stubo
+// before it is sent, AfterUpstream is called with Stubo response before it is
+// read, so it can replace response body
+type Transformer = stubo.Transformer
+
+// allRoutes - registry key of transformers that are used for every route
+const allRoutes = "*"
+
+// TransformerRegistry keeps transformers by legacy route path, e.g.
+// "/stubo/api/put/stub" or route pattern with variables, e.g.
+// "/stubo/api/put/scenarios/:scenario". Transformers are called in
+// registration order, transformers registered for "*" are called before
+// route transformers
+type TransformerRegistry struct {
+	mu           sync.RWMutex
+	transformers map[string][]Transformer
+}
+
+// NewTransformerRegistry returns registry with given transformers
+func NewTransformerRegistry(transformers map[string][]Transformer) *TransformerRegistry {
+	t := &TransformerRegistry{transformers: make(map[string][]Transformer)}
+	for route, routeTransformers := range transformers {
+		t.Register(route, routeTransformers...)
+	}
+	return t
+}
+
+// Register adds transformers for legacy route, use "*" for all routes
+func (t *TransformerRegistry) Register(route string, transformers ...Transformer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transformers[route] = append(t.transformers[route], transformers...)
+}
+
+// Get returns transformer that calls all transformers of legacy request path,
+// nil is returned when path has no transformers. Transformers of matching
+// route patterns are called after transformers of exact path
+func (t *TransformerRegistry) Get(path string) Transformer {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var chain transformerChain
+	chain = append(chain, t.transformers[allRoutes]...)
+	chain = append(chain, t.transformers[path]...)
+	patterns := make([]string, 0, len(t.transformers))
+	for route := range t.transformers {
+		if route != path && strings.Contains(route, "/:") && routeMatches(route, path) {
+			patterns = append(patterns, route)
+		}
+	}
+	sort.Strings(patterns)
+	for _, route := range patterns {
+		chain = append(chain, t.transformers[route]...)
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain
+}
+
+// routeMatches checks whether path matches route pattern, pattern segments
+// starting with ":" match any non-empty path segment
+func routeMatches(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, ":") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// transformerChain calls transformers one after another
+type transformerChain []Transformer
+
+func (c transformerChain) BeforeUpstream(req *http.Request) {
+	for _, t := range c {
+		t.BeforeUpstream(req)
+	}
+}
+
+func (c transformerChain) AfterUpstream(resp *http.Response) {
+	for _, t := range c {
+		t.AfterUpstream(resp)
+	}
+}
+
+// TransformerFuncs adapts functions to Transformer, nil functions are skipped
+type TransformerFuncs struct {
+	Before func(*http.Request)
+	After  func(*http.Response)
+}
+
+// BeforeUpstream calls Before
+func (f TransformerFuncs) BeforeUpstream(req *http.Request) {
+	if f.Before != nil {
+		f.Before(req)
+	}
+}
+
+// AfterUpstream calls After
+func (f TransformerFuncs) AfterUpstream(resp *http.Response) {
+	if f.After != nil {
+		f.After(resp)
+	}
+}
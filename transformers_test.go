@@ -0,0 +1,144 @@
+package lgc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyTransformers(t *testing.T) {
+	t.Parallel()
+	var delayPolicy string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delayPolicy = r.Header.Get("delay_policy")
+		fmt.Fprint(w, `{"version": "0.6.6", "data": {"host": "stubo.internal"}}`)
+	}))
+	defer server.Close()
+
+	cfg := proxyConfig(t, server)
+	var calls []string
+	cfg.Transformers = map[string][]Transformer{
+		"*": {TransformerFuncs{Before: func(req *http.Request) {
+			calls = append(calls, "all")
+		}}},
+		"/stubo/api/put/stub": {TransformerFuncs{Before: func(req *http.Request) {
+			calls = append(calls, "put/stub")
+			if req.Header.Get("delay_policy") == "" {
+				req.Header.Set("delay_policy", "slow")
+			}
+		}}},
+	}
+	proxy, err := NewProxy(cfg)
+	expect(t, err, nil)
+	defer proxy.Close()
+	// rewriting hostnames in responses
+	proxy.RegisterTransformer("/stubo/api/put/stub", TransformerFuncs{After: func(resp *http.Response) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body = ioutil.NopCloser(strings.NewReader(strings.Replace(string(body), "stubo.internal", "stubo.example.com", -1)))
+	}})
+
+	req, err := http.NewRequest("POST", "/stubo/api/put/stub?session=first:first_1", strings.NewReader(`{"request": {}}`))
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, delayPolicy, "slow")
+	expect(t, strings.Join(calls, ","), "all,put/stub")
+	expect(t, strings.Contains(respRec.Body.String(), "stubo.example.com"), true)
+
+	// other routes get only transformers of all routes
+	calls = nil
+	req, err = http.NewRequest("GET", "/stubo/api/get/stublist?scenario=first", nil)
+	expect(t, err, nil)
+	respRec = httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, delayPolicy, "")
+	expect(t, strings.Join(calls, ","), "all")
+	expect(t, strings.Contains(respRec.Body.String(), "stubo.internal"), true)
+}
+
+func TestTransformerRegistryEmpty(t *testing.T) {
+	var registry *TransformerRegistry
+	expect(t, registry.Get("/stubo/api/put/stub"), nil)
+	expect(t, NewTransformerRegistry(nil).Get("/stubo/api/put/stub"), nil)
+}
+
+func TestProxyTransformersRoutePattern(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"version": "0.6.6", "data": {"message": "ok"}}`)
+	}))
+	defer server.Close()
+
+	cfg := proxyConfig(t, server)
+	var calls []string
+	cfg.Transformers = map[string][]Transformer{
+		"/stubo/api/put/scenarios/:scenario": {TransformerFuncs{Before: func(req *http.Request) {
+			calls = append(calls, req.Method+" "+req.URL.Path)
+		}}},
+	}
+	proxy, err := NewProxy(cfg)
+	expect(t, err, nil)
+	defer proxy.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/put/scenarios/first?new_name=second", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(respRec, req)
+
+	// every call of rename workflow goes through pattern transformers
+	expect(t, len(calls) > 0, true)
+	expect(t, strings.HasPrefix(calls[0], "GET /stubo/api/v2/scenarios/objects/first"), true)
+}
+
+func TestProxyTransformersLegacyStubo(t *testing.T) {
+	t.Parallel()
+	var module string
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		module = r.Header.Get("module")
+		fmt.Fprint(w, "stubo.internal")
+	}))
+	defer legacy.Close()
+
+	cfg := Configuration{LegacyStuboURI: legacy.URL}
+	cfg.Transformers = map[string][]Transformer{
+		"/stubo/api/put/module": {TransformerFuncs{
+			Before: func(req *http.Request) {
+				req.Header.Set("module", "first")
+			},
+			After: func(resp *http.Response) {
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body = ioutil.NopCloser(strings.NewReader(strings.Replace(string(body), "stubo.internal", "stubo.example.com", -1)))
+				resp.Header.Del("Content-Length")
+			},
+		}},
+	}
+	proxy, err := NewProxy(cfg)
+	expect(t, err, nil)
+	defer proxy.Close()
+
+	req, err := http.NewRequest("GET", "/stubo/api/put/module?name=first", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	proxy.Handler().ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, module, "first")
+	expect(t, respRec.Body.String(), "stubo.example.com")
+}
+
+func TestTransformerRegistryPatterns(t *testing.T) {
+	registry := NewTransformerRegistry(map[string][]Transformer{
+		"*":                                  {TransformerFuncs{}},
+		"/stubo/api/put/scenarios/:scenario": {TransformerFuncs{}},
+	})
+	expect(t, len(registry.Get("/stubo/api/put/scenarios/first").(transformerChain)), 2)
+	expect(t, len(registry.Get("/stubo/api/put/scenarios").(transformerChain)), 1)
+	expect(t, len(registry.Get("/stubo/api/put/scenarios/first/stubs").(transformerChain)), 1)
+}
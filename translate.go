@@ -0,0 +1,120 @@
+package lgc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rusenask/lgc/stubo"
+)
+
+// Response modes of translated legacy API calls
+const (
+	// responsePassthrough - Stubo API v2 response is returned unchanged
+	responsePassthrough = "passthrough"
+	// responseLegacy - Stubo API v2 response is converted into legacy API response
+	responseLegacy = "legacy"
+)
+
+// translatedRoutes - legacy API calls which responses can be converted into
+// legacy structures
+var translatedRoutes = []string{"get/stublist", "get/scenarios", "begin/session"}
+
+// validateResponseModes checks that response modes are only set for routes
+// that can be translated and have known values
+func validateResponseModes(modes map[string]string) error {
+	for route, mode := range modes {
+		known := false
+		for _, r := range translatedRoutes {
+			if r == route {
+				known = true
+			}
+		}
+		if !known {
+			return fmt.Errorf("responses: route '%s' can't be translated, use one of: %s",
+				route, strings.Join(translatedRoutes, ", "))
+		}
+		if mode != responsePassthrough && mode != responseLegacy {
+			return fmt.Errorf("responses: unknown mode '%s' for route '%s', use '%s' or '%s'",
+				mode, route, responseLegacy, responsePassthrough)
+		}
+	}
+	return nil
+}
+
+// responseMode returns response mode of given legacy route, responses are
+// passed through by default
+func (h HandlerHTTPClient) responseMode(route string) string {
+	if mode, ok := h.config.Responses[route]; ok {
+		return mode
+	}
+	return responsePassthrough
+}
+
+// LegacyStubListResponse is a legacy API response for get/stublist
+type LegacyStubListResponse struct {
+	Version string `json:"version"`
+	Data    struct {
+		Scenario string            `json:"scenario"`
+		Stubs    []json.RawMessage `json:"stubs"`
+	} `json:"data"`
+}
+
+// LegacyScenariosResponse is a legacy API response for get/scenarios
+type LegacyScenariosResponse struct {
+	Version string `json:"version"`
+	Data    struct {
+		Host      string   `json:"host,omitempty"`
+		Scenarios []string `json:"scenarios"`
+	} `json:"data"`
+}
+
+// LegacySessionResponse is a legacy API response for begin/session
+type LegacySessionResponse struct {
+	Version string `json:"version"`
+	Data    struct {
+		Status   string `json:"status"`
+		Session  string `json:"session"`
+		Scenario string `json:"scenario"`
+		Message  string `json:"message"`
+	} `json:"data"`
+}
+
+// translateStubList unwraps stubs from API v2 stub detail wrappers
+func translateStubList(scenario string, stubs *stubo.ScenarioStubsResponse) LegacyStubListResponse {
+	var legacy LegacyStubListResponse
+	legacy.Version = stubs.Version
+	legacy.Data.Scenario = scenario
+	legacy.Data.Stubs = make([]json.RawMessage, 0, len(stubs.Data))
+	for _, stub := range stubs.Data {
+		legacy.Data.Stubs = append(legacy.Data.Stubs, stub.Stub)
+	}
+	return legacy
+}
+
+// translateScenarios converts API v2 scenario objects into list of scenario
+// names, when host is given only scenarios of that host are listed
+func translateScenarios(host string, scenarios *stubo.ScenariosResponse) LegacyScenariosResponse {
+	var legacy LegacyScenariosResponse
+	legacy.Version = scenarios.Version
+	legacy.Data.Host = host
+	legacy.Data.Scenarios = make([]string, 0, len(scenarios.Data))
+	for _, scenario := range scenarios.Data {
+		if host == "" || strings.HasPrefix(scenario.Name, host+":") {
+			legacy.Data.Scenarios = append(legacy.Data.Scenarios, scenario.Name)
+		}
+	}
+	return legacy
+}
+
+// translateSession converts API v2 session status into legacy begin/session
+// response
+func translateSession(status *stubo.SessionStatusResponse) LegacySessionResponse {
+	var legacy LegacySessionResponse
+	legacy.Version = status.Version
+	legacy.Data.Status = status.Data.Status
+	legacy.Data.Session = status.Data.Session
+	legacy.Data.Scenario = status.Data.Scenario
+	legacy.Data.Message = status.Data.Message
+	return legacy
+}
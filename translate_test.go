@@ -0,0 +1,87 @@
+package lgc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStublistHandlerLegacyResponse(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": [{"stub": {"request": {"method": "POST"}, "response": {"status": 200}},
+		"matchers_hash": "123"}]}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	m := setupConfig(*c, Configuration{Responses: map[string]string{"get/stublist": "legacy"}})
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/stublist?scenario=first", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	var legacy LegacyStubListResponse
+	err = json.Unmarshal(respRec.Body.Bytes(), &legacy)
+	expect(t, err, nil)
+	expect(t, legacy.Version, "0.6.6")
+	expect(t, legacy.Data.Scenario, "first")
+	expect(t, len(legacy.Data.Stubs), 1)
+	expect(t, strings.Contains(string(legacy.Data.Stubs[0]), `"request"`), true)
+	expect(t, strings.Contains(string(legacy.Data.Stubs[0]), "matchers_hash"), false)
+}
+
+func TestGetScenariosHandlerLegacyResponse(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": [
+		{"name": "localhost:first", "scenarioRef": "/stubo/api/v2/scenarios/objects/localhost:first"},
+		{"name": "otherhost:second", "scenarioRef": "/stubo/api/v2/scenarios/objects/otherhost:second"}]}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	m := setupConfig(*c, Configuration{Responses: map[string]string{"get/scenarios": "legacy"}})
+
+	req, err := http.NewRequest("GET", "/stubo/api/get/scenarios?host=localhost", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	var legacy LegacyScenariosResponse
+	err = json.Unmarshal(respRec.Body.Bytes(), &legacy)
+	expect(t, err, nil)
+	expect(t, legacy.Data.Host, "localhost")
+	expect(t, len(legacy.Data.Scenarios), 1)
+	expect(t, legacy.Data.Scenarios[0], "localhost:first")
+}
+
+func TestBeginSessionHandlerLegacyResponse(t *testing.T) {
+	testData := `{"version": "0.6.6", "data": {"status": "record", "session": "first_1",
+		"scenario": "localhost:first", "scenarioRef": "/stubo/api/v2/scenarios/objects/localhost:first",
+		"message": "Record mode initiated...."}}`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	m := setupConfig(*c, Configuration{Responses: map[string]string{"begin/session": "legacy"}})
+
+	req, err := http.NewRequest("GET", "/stubo/api/begin/session?scenario=first&session=first_1&mode=record", nil)
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	body, err := ioutil.ReadAll(respRec.Body)
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, strings.Contains(string(body), "scenarioRef"), false)
+	var legacy LegacySessionResponse
+	err = json.Unmarshal(body, &legacy)
+	expect(t, err, nil)
+	expect(t, legacy.Data.Status, "record")
+	expect(t, legacy.Data.Session, "first_1")
+	expect(t, legacy.Data.Scenario, "localhost:first")
+	expect(t, legacy.Data.Message, "Record mode initiated....")
+}
+
+func TestValidateResponseModes(t *testing.T) {
+	expect(t, validateResponseModes(nil), nil)
+	expect(t, validateResponseModes(map[string]string{"get/stublist": "passthrough"}), nil)
+	refute(t, validateResponseModes(map[string]string{"get/stublist": "v1"}), nil)
+	refute(t, validateResponseModes(map[string]string{"put/stub": "legacy"}), nil)
+}
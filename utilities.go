@@ -1,52 +1,202 @@
-package main
+package lgc
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
-	"runtime"
+	"net/url"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/rusenask/lgc/internal/util"
+	"github.com/rusenask/lgc/stubo"
 )
 
-func getURLHeadersArgs(expectedHeaders map[string]bool, urlQuery map[string][]string) (map[string]string, string) {
-	var bufferArgs bytes.Buffer
+// defaultHeaderArgs - URL query arguments that Stubo expects in headers
+// instead of URL query in API v2, by legacy route
+var defaultHeaderArgs = map[string][]string{
+	"put/stub":     {"ext_module", "delay_policy", "stateful", "stub_created_date"},
+	"get/response": {},
+}
+
+// validateArguments checks that arguments are only configured for routes
+// that forward URL query arguments to Stubo
+func validateArguments(arguments map[string]ArgumentsConfig) error {
+	for route := range arguments {
+		if _, ok := defaultHeaderArgs[route]; !ok {
+			return fmt.Errorf("arguments: route '%s' doesn't forward arguments, use 'put/stub' or 'get/response'", route)
+		}
+	}
+	return nil
+}
+
+// headerArgs returns URL query arguments of given legacy route that are sent
+// to Stubo as headers
+func (h HandlerHTTPClient) headerArgs(route string) map[string]bool {
+	names := defaultHeaderArgs[route]
+	if cfg, ok := h.config.Arguments[route]; ok {
+		names = cfg.Headers
+	}
+	headers := make(map[string]bool)
+	for _, name := range names {
+		headers[name] = true
+	}
+	return headers
+}
+
+// queryArg is a single URL query argument
+type queryArg struct {
+	key, value string
+}
+
+// parseQueryArgs parses raw URL query keeping order of arguments and repeated
+// keys, which url.ParseQuery loses. Arguments that can't be unescaped are
+// kept as they are
+func parseQueryArgs(rawQuery string) []queryArg {
+	var args []queryArg
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		key, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			key, value = part[:i], part[i+1:]
+		}
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		args = append(args, queryArg{key: key, value: value})
+	}
+	return args
+}
+
+// getURLHeadersArgs splits raw URL query into Stubo headers and URL query
+// that is forwarded to Stubo. Forwarded arguments keep their order and
+// repeated keys and are encoded again, only the first value of header
+// argument is used. Skipped arguments are not forwarded at all
+func getURLHeadersArgs(expectedHeaders map[string]bool, rawQuery string, skip ...string) (map[string]string, string) {
 	headers := make(map[string]string)
-	// getting more headers and forming query argument
-	for key, value := range urlQuery {
+	var forwarded []string
+	for _, arg := range parseQueryArgs(rawQuery) {
+		if isSkipped(arg.key, skip) {
+			continue
+		}
 		// if key is in expected headers (Stubo expects these to be in headers
 		// instead of URL query in API v2, transforming them..)
-		if expectedHeaders[key] {
-			headers[key] = value[0]
-		} else {
-			bufferArgs.WriteString(key + "=" + value[0] + "&")
+		if expectedHeaders[arg.key] {
+			if _, ok := headers[arg.key]; !ok {
+				headers[arg.key] = arg.value
+			}
+			continue
 		}
+		forwarded = append(forwarded, url.QueryEscape(arg.key)+"="+url.QueryEscape(arg.value))
 	}
-	args := bufferArgs.String()
-	return headers, args
+	return headers, strings.Join(forwarded, "&")
 }
 
-// trace returns name of the current function
-func trace() string {
-	pc := make([]uintptr, 10) // at least 1 entry needed
-	runtime.Callers(2, pc)
-	f := runtime.FuncForPC(pc[0])
-	return f.Name()
+// isSkipped checks whether key is one of skipped keys
+func isSkipped(key string, skip []string) bool {
+	for _, s := range skip {
+		if key == s {
+			return true
+		}
+	}
+	return false
 }
 
-func httperror(w http.ResponseWriter, r *http.Request, err error) {
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		log.WithFields(log.Fields{
-			"url_query": r.URL.Query(),
-			"url_path":  r.URL.Path,
-			"error":     err.Error(),
-		}).Error("Got error during HTTP request to Stubo")
+// httperror logs failed legacy API call and writes error to the client in
+// legacy Stubo error envelope
+func (h HandlerHTTPClient) httperror(w http.ResponseWriter, r *http.Request, err error) {
+	if err == nil {
+		return
+	}
+	writeError(w, err)
+	logger := h.logger().WithFields(log.Fields{
+		"url_query": r.URL.Query(),
+		"url_path":  r.URL.Path,
+		"error":     err.Error(),
+	})
+	switch {
+	case errors.Is(err, stubo.ErrCircuitOpen):
+		logger.Warn("Circuit breaker is open, request to Stubo was not made")
+	case legacyError(err).Code < 500:
+		logger.Warn("Legacy API call failed")
+	default:
+		logger.Error("Got error during HTTP request to Stubo")
 	}
 }
 
+// limitBody enforces configured maximum request body size without buffering
+// the body. Returns 413 error if request declares larger body, bodies without
+// declared length fail while being streamed.
+func (h HandlerHTTPClient) limitBody(w http.ResponseWriter, r *http.Request) error {
+	max := h.config.MaxBodyBytes
+	if max <= 0 || r.Body == nil {
+		return nil
+	}
+	if r.ContentLength > max {
+		return &Error{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Request body is too large (%d bytes, limit is %d bytes).", r.ContentLength, max),
+		}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, max)
+	return nil
+}
+
+// maxErrorBodyBytes - size limit of streamed Stubo error response body
+const maxErrorBodyBytes = 1 << 20
+
+// streamResponse copies Stubo response to the client without buffering it and
+// closes response body. Stubo error responses are returned as errors, so the
+// client gets them in legacy error envelope. Error is returned only when
+// nothing was written
+func (h HandlerHTTPClient) streamResponse(w http.ResponseWriter, r *http.Request, resp *http.Response, contentType string) error {
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return stuboResponseError(resp.StatusCode, body)
+	}
+	max := h.config.MaxBodyBytes
+	if max > 0 && resp.ContentLength > max {
+		return &Error{
+			Code:    http.StatusBadGateway,
+			Message: fmt.Sprintf("Stubo response is too large (%d bytes, limit is %d bytes).", resp.ContentLength, max),
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		h.logger().WithFields(log.Fields{
+			"url_path": r.URL.Path,
+			"error":    err.Error(),
+		}).Warn("Failed to stream Stubo response to the client")
+	}
+	return nil
+}
+
+// stuboResponseError returns legacy error for Stubo error response, message
+// and version are taken from API v2 error envelope if body contains one
+func stuboResponseError(statusCode int, body []byte) *Error {
+	e := &Error{
+		Code:    statusCode,
+		Message: fmt.Sprintf("Stubo responded with status code %d.", statusCode),
+	}
+	var envelope stubo.ErrorResponse
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error.Message != "" {
+		e.Message = envelope.Error.Message
+		e.Version = envelope.Version
+	}
+	return e
+}
+
 // getSession looks for session both in URL query and request headers
 func getSession(r *http.Request) (string, bool) {
 	urlQuery := r.URL.Query()
@@ -62,20 +212,44 @@ func getSession(r *http.Request) (string, bool) {
 	return "", false
 }
 
+// splitArg splits argument value such as "scenario:session" by ":" into
+// exactly n parts, false is returned when parts are missing or there are
+// extra colons
+func splitArg(value string, n int) ([]string, bool) {
+	parts := strings.Split(value, ":")
+	return parts, len(parts) == n
+}
+
+// splitSession splits "scenario:session" value into scenario and session.
+// Plain session names (used by legacy commands files) are looked up in
+// sessions started through LGC, nil is returned for invalid values
+func (h HandlerHTTPClient) splitSession(r *http.Request, value string) []string {
+	slices, ok := splitArg(value, 2)
+	if ok {
+		return slices
+	}
+	if len(slices) == 1 {
+		if info, ok := h.sessions.Get(requestTenant(r), value); ok {
+			return []string{info.Scenario, value}
+		}
+	}
+	return nil
+}
+
 // deleteAllDelayPolicies - custom handler to delete multiple delay policies.
 // This API call is not directly available through API v2 so we are taking
 // response with all delay policies - unmarshalling it, getting all names
 // and then deleting them one by one
-func (c *Client) deleteAllDelayPolicies(dp []byte) ([]byte, error) {
+func (h HandlerHTTPClient) deleteAllDelayPolicies(ctx context.Context, client *stubo.Client, dp []byte) ([]byte, error) {
 	// getting all delay policy names
 	allDelayPolicies := dp
 	// Unmarshaling JSON
-	var data DelayPolicyResponse
+	var data stubo.DelayPolicyResponse
 	err := json.Unmarshal(allDelayPolicies, &data)
 
 	// logging
-	method := trace()
-	log.WithFields(log.Fields{
+	method := util.Trace()
+	h.logger().WithFields(log.Fields{
 		"func":          method,
 		"delayPolicies": data,
 	}).Info("Deleting delay policies")
@@ -89,21 +263,26 @@ func (c *Client) deleteAllDelayPolicies(dp []byte) ([]byte, error) {
 	// Deleting delay policies
 	var responses []string
 	for _, dp := range data.Data {
-		_, _, err := c.deleteDelayPolicy(dp.Name)
+		_, err := client.DeleteDelayPolicy(ctx, dp.Name)
 
 		if err == nil {
 			responses = append(responses, dp.Name)
 		} else {
-			log.WithFields(log.Fields{
+			h.logger().WithFields(log.Fields{
 				"func":  method,
 				"error": err.Error(),
 			}).Warn("Failed to delete delay policy")
+			// remaining policies can't be deleted once call is cancelled
+			// or timed out
+			if ctx.Err() != nil {
+				return []byte(""), err
+			}
 		}
 	}
 	// creating message for the client
 	message := fmt.Sprintf("Deleted %d delay policies: ", len(responses)) + strings.Join(responses, " ")
 
-	log.WithFields(log.Fields{
+	h.logger().WithFields(log.Fields{
 		"func":     method,
 		"response": message,
 	}).Info("Delay policies deleted")
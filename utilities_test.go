@@ -0,0 +1,108 @@
+package lgc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestDeleteAllDelayPolicies passes stubbed response from API v2 containing
+// 3 delay policies to deleteAllDelayPolicies function and expects result with
+// message that all three policies were deleted. Httptest server returns 200
+// for all three deletions
+func TestDeleteAllDelayPolicies(t *testing.T) {
+	delayPoliciesBytes := []byte(`{"version": "0.6.6",
+																 "data": [
+																					{"delay_type":
+																					 "fixed",
+																			  	 "delayPolicyRef": "/stubo/api/v2/delay-policy/objects/my_delay",
+																					 "name": "my_delay",
+																					 "milliseconds": 50},
+																					{"delay_type": "fixed",
+																					"delayPolicyRef":
+																					"/stubo/api/v2/delay-policy/objects/my_delay2",
+																					"name": "my_delay2", "milliseconds": 50},
+																					{"delay_type": "fixed",
+																					"delayPolicyRef": "/stubo/api/v2/delay-policy/objects/my_delay1",
+																					"name": "my_delay1",
+																					"milliseconds": 50}]}`)
+	testData := `{"version":"1.2.3","data": [{"some: "data"}]`
+	server, c := testTools(200, testData)
+	defer server.Close()
+	h := HandlerHTTPClient{http: *c}
+	response, err := h.deleteAllDelayPolicies(context.Background(), c, delayPoliciesBytes)
+	resp := string(response)
+	expect(t, strings.Contains(resp, "Deleted 3 delay policies: my_delay my_delay2 my_delay1"), true)
+	expect(t, err, nil)
+}
+
+// TestDeleteAllDelayPoliciesShape checks that delete-all response has legacy
+// Stubo shape, version and message must not be swapped
+func TestDeleteAllDelayPoliciesShape(t *testing.T) {
+	delayPoliciesBytes := []byte(`{"version": "0.6.6", "data": [{"name": "my_delay"}]}`)
+	server, c := testTools(200, `{"version": "0.6.6", "data": {"message": "Deleted 1 delay policies"}}`)
+	defer server.Close()
+	h := HandlerHTTPClient{http: *c}
+	response, err := h.deleteAllDelayPolicies(context.Background(), c, delayPoliciesBytes)
+	expect(t, err, nil)
+
+	var legacy struct {
+		Version string            `json:"version"`
+		Data    map[string]string `json:"data"`
+	}
+	err = json.Unmarshal(response, &legacy)
+	expect(t, err, nil)
+	expect(t, legacy.Version, "0.6.6")
+	expect(t, strings.HasPrefix(legacy.Data["message"], "Deleted 1 delay policies"), true)
+}
+
+func TestGetURLHeadersArgs(t *testing.T) {
+	expectedHeaders := map[string]bool{"delay_policy": true}
+	rawQuery := "session=first:first_1&b=2&a=1&a=3&delay_policy=slow&delay_policy=fast&q=a%20b%26c&empty"
+	headers, args := getURLHeadersArgs(expectedHeaders, rawQuery, "session")
+
+	// order and repeated keys are kept, values are encoded, no trailing &
+	expect(t, args, "b=2&a=1&a=3&q=a+b%26c&empty=")
+	expect(t, len(headers), 1)
+	expect(t, headers["delay_policy"], "slow")
+}
+
+func TestGetURLHeadersArgsEmpty(t *testing.T) {
+	headers, args := getURLHeadersArgs(map[string]bool{}, "session=first:first_1", "session")
+	expect(t, args, "")
+	expect(t, len(headers), 0)
+}
+
+// TestPutStubHandlerArgumentsConfig - configured header arguments replace
+// default ones for put/stub route
+func TestPutStubHandlerArgumentsConfig(t *testing.T) {
+	var query, delayPolicy, tracking string
+	server, c := testToolsHandler(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		delayPolicy = r.Header.Get("delay_policy")
+		tracking = r.Header.Get("tracking_level")
+		w.Write([]byte(`{"version": "0.6.6", "data": {}}`))
+	})
+	defer server.Close()
+	m := setupConfig(*c, Configuration{Arguments: map[string]ArgumentsConfig{
+		"put/stub": {Headers: []string{"tracking_level"}},
+	}})
+
+	req, err := http.NewRequest("POST", "/stubo/api/put/stub?session=first:first_1&delay_policy=slow&tracking_level=full&x=1", strings.NewReader("{}"))
+	expect(t, err, nil)
+	respRec := httptest.NewRecorder()
+	m.ServeHTTP(respRec, req)
+
+	expect(t, respRec.Code, http.StatusOK)
+	expect(t, query, "delay_policy=slow&x=1")
+	expect(t, delayPolicy, "")
+	expect(t, tracking, "full")
+}
+
+func TestValidateArguments(t *testing.T) {
+	expect(t, validateArguments(map[string]ArgumentsConfig{"get/response": {Headers: []string{"a"}}}), nil)
+	refute(t, validateArguments(map[string]ArgumentsConfig{"get/stublist": {}}), nil)
+}